@@ -0,0 +1,31 @@
+package admin
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/gorilla/mux"
+)
+
+func GetAppointmentHistory(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	data, err := queries.GetAppointmentHistory(uint(id), queries.Actor{UserID: claims.UserID, Role: models.ActorAdmin})
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Appointment history retrieved")
+}
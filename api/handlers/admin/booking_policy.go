@@ -0,0 +1,41 @@
+package admin
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+)
+
+func GetBookingPolicy(w http.ResponseWriter, r *http.Request) {
+	policy, err := queries.GetBookingPolicy()
+	if err != nil {
+		response.ServerError(w, "Could not fetch booking policy")
+		return
+	}
+
+	response.Success(w, policy, "Booking policy retrieved")
+}
+
+func UpdateBookingPolicy(w http.ResponseWriter, r *http.Request) {
+	var body queries.UpdateBookingPolicyBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	policy, err := queries.UpdateBookingPolicy(body)
+	if err != nil {
+		response.ServerError(w, "Failed to update booking policy")
+		return
+	}
+
+	response.Success(w, policy, "Booking policy updated successfully")
+}
@@ -0,0 +1,98 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+func GetInsuranceProviders(w http.ResponseWriter, r *http.Request) {
+	data, err := queries.GetInsuranceProviders(false)
+	if err != nil {
+		response.ServerError(w, "Could not fetch insurance providers")
+		return
+	}
+
+	response.Success(w, data, "Insurance providers retrieved")
+}
+
+func decodeInsuranceProvider(w http.ResponseWriter, r *http.Request) (*queries.InsuranceProviderBody, bool) {
+	var body queries.InsuranceProviderBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return nil, false
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return &body, true
+}
+
+func CreateInsuranceProvider(w http.ResponseWriter, r *http.Request) {
+	body, ok := decodeInsuranceProvider(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := queries.CreateInsuranceProvider(*body)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Insurance provider created successfully")
+}
+
+func UpdateInsuranceProvider(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	body, ok := decodeInsuranceProvider(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := queries.UpdateInsuranceProvider(uint(id), *body)
+	if err != nil {
+		if errors.Is(err, queries.ErrInsuranceProviderNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Insurance provider updated successfully")
+}
+
+func DeleteInsuranceProvider(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	if err := queries.DeleteInsuranceProvider(uint(id)); err != nil {
+		if errors.Is(err, queries.ErrInsuranceProviderNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.Error(w, http.StatusConflict, err.Error())
+		return
+	}
+
+	response.Success(w, nil, "Insurance provider deleted successfully")
+}
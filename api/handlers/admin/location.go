@@ -0,0 +1,53 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+func GetLocations(w http.ResponseWriter, r *http.Request) {
+	data, err := queries.GetLocations(r.URL.Query().Get("city"))
+	if err != nil {
+		response.ServerError(w, "Failed to fetch locations")
+		return
+	}
+	response.Success(w, data, "Locations retrieved")
+}
+
+func UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	var body queries.LocationBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.UpdateLocation(uint(id), body)
+	if err != nil {
+		if errors.Is(err, queries.ErrLocationNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, data, "Location updated successfully")
+}
@@ -0,0 +1,58 @@
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+func GetReviewQueue(w http.ResponseWriter, r *http.Request) {
+	data, err := queries.GetModerationQueue(r.URL.Query().Get("filter"))
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Reviews retrieved successfully")
+}
+
+func ModerateReview(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	var body queries.ModerateReviewBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.ModerateReview(claims.UserID, uint(id), body)
+	if err != nil {
+		if errors.Is(err, queries.ErrReviewNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Review moderated successfully")
+}
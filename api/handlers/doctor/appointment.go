@@ -2,13 +2,17 @@ package doctor
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/models"
 	"github.com/YahiaJouini/careflow/internal/db/queries"
 	"github.com/YahiaJouini/careflow/pkg/auth"
 	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
 	"github.com/gorilla/mux"
 )
 
@@ -34,9 +38,16 @@ func ValidateAppointment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := queries.ValidateAppointment(claims.UserID, uint(id), req.Status)
+	data, err := queries.ValidateAppointment(claims.UserID, uint(id), req)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, err.Error())
+		switch {
+		case errors.Is(err, queries.ErrAppointmentNotFound):
+			response.Error(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, queries.ErrInvalidTransition):
+			response.Error(w, http.StatusConflict, err.Error())
+		default:
+			response.Error(w, http.StatusBadRequest, err.Error())
+		}
 		return
 	}
 	response.Success(w, data, "Appointment status updated")
@@ -53,9 +64,16 @@ func UpdateAppointment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := queries.UpdateAppointmentDoctor(claims.UserID, uint(id), req)
+	data, err := queries.UpdateAppointmentDoctor(claims.UserID, uint(id), req, r.URL.Query().Get("scope"))
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, err.Error())
+		switch {
+		case errors.Is(err, queries.ErrAppointmentNotFound):
+			response.Error(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, queries.ErrSlotTaken), errors.Is(err, queries.ErrDoctorOnTimeOff):
+			response.Error(w, http.StatusConflict, err.Error())
+		default:
+			response.Error(w, http.StatusBadRequest, err.Error())
+		}
 		return
 	}
 	response.Success(w, data, "Appointment updated successfully")
@@ -66,10 +84,51 @@ func CancelAppointment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	err := queries.CancelAppointmentDoctor(claims.UserID, uint(id))
+	var req queries.CancelAppointmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err := queries.CancelAppointmentDoctor(claims.UserID, uint(id), req, r.URL.Query().Get("scope"))
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Appointment not found")
+		if errors.Is(err, queries.ErrAppointmentNotFound) {
+			response.Error(w, http.StatusNotFound, "Appointment not found")
+			return
+		}
+		response.Error(w, http.StatusConflict, err.Error())
 		return
 	}
 	response.Success(w, nil, "Appointment cancelled")
 }
+
+func GetAppointmentHistory(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	data, err := queries.GetAppointmentHistory(uint(id), queries.Actor{UserID: claims.UserID, Role: models.ActorDoctor})
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	response.Success(w, data, "Appointment history retrieved")
+}
+
+func DownloadAppointmentCalendar(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	calendar, err := queries.GetAppointmentCalendar(uint(id), queries.Actor{UserID: claims.UserID, Role: models.ActorDoctor})
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	response.Calendar(w, calendar, fmt.Sprintf("appointment-%d.ics", id))
+}
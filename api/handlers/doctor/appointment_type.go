@@ -0,0 +1,92 @@
+package doctor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+func GetAppointmentTypes(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.GetDoctorAppointmentTypes(claims.UserID)
+	if err != nil {
+		response.ServerError(w, "Failed to fetch appointment types")
+		return
+	}
+	response.Success(w, data, "Appointment types retrieved")
+}
+
+func CreateAppointmentType(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	var body queries.AppointmentTypeBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.CreateAppointmentType(claims.UserID, body)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, data, "Appointment type created successfully")
+}
+
+func UpdateAppointmentType(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var body queries.AppointmentTypeBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.UpdateAppointmentType(claims.UserID, uint(id), body)
+	if err != nil {
+		if errors.Is(err, queries.ErrAppointmentTypeNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, data, "Appointment type updated successfully")
+}
+
+func DeleteAppointmentType(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	if err := queries.DeleteAppointmentType(claims.UserID, uint(id)); err != nil {
+		if errors.Is(err, queries.ErrAppointmentTypeNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, nil, "Appointment type deleted successfully")
+}
@@ -0,0 +1,72 @@
+package doctor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+)
+
+func GetCalendarSync(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.GetCalendarSync(claims.UserID)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	response.Success(w, data, "Calendar sync retrieved")
+}
+
+func UpdateCalendarSync(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	var req queries.CalendarSyncBody
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.UpdateCalendarSync(claims.UserID, req)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, data, "Calendar sync updated")
+}
+
+func DeleteCalendarSync(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	if err := queries.DeleteCalendarSync(claims.UserID); err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	response.Success(w, nil, "Calendar sync removed")
+}
+
+func RunCalendarSync(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.SyncDoctorCalendar(claims.UserID)
+	if err != nil {
+		if data == nil || errors.Is(err, queries.ErrCalendarSyncNotConfigured) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		// the calendar server failed, the error is also kept on the config
+		response.Error(w, http.StatusBadGateway, err.Error())
+		return
+	}
+	response.Success(w, data, "Calendar synced")
+}
@@ -0,0 +1,45 @@
+package doctor
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+)
+
+func GetInsuranceProviders(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.GetDoctorInsurances(claims.UserID)
+	if err != nil {
+		response.ServerError(w, "Failed to fetch accepted insurances")
+		return
+	}
+	response.Success(w, data, "Accepted insurances retrieved")
+}
+
+func UpdateInsuranceProviders(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	var body queries.DoctorInsurancesBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.SetDoctorInsurances(claims.UserID, body)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, data, "Accepted insurances updated successfully")
+}
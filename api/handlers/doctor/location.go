@@ -0,0 +1,113 @@
+package doctor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+func GetLocations(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.GetDoctorLocations(claims.UserID)
+	if err != nil {
+		response.ServerError(w, "Failed to fetch locations")
+		return
+	}
+	response.Success(w, data, "Locations retrieved")
+}
+
+func CreateLocation(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	var body queries.LocationBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.CreateDoctorLocation(claims.UserID, body)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, data, "Location created successfully")
+}
+
+func AttachLocation(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	data, err := queries.AttachLocation(claims.UserID, uint(id))
+	if err != nil {
+		if errors.Is(err, queries.ErrLocationNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, data, "Location added successfully")
+}
+
+func UpdateLocation(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var body queries.LocationBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.UpdateDoctorLocation(claims.UserID, uint(id), body)
+	if err != nil {
+		if errors.Is(err, queries.ErrLocationNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if errors.Is(err, queries.ErrLocationReadOnly) {
+			response.Error(w, http.StatusForbidden, err.Error())
+			return
+		}
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, data, "Location updated successfully")
+}
+
+func DetachLocation(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	if err := queries.DetachLocation(claims.UserID, uint(id)); err != nil {
+		if errors.Is(err, queries.ErrLocationNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, nil, "Location removed successfully")
+}
@@ -50,6 +50,12 @@ func GetPatientDetails(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	noShows, err := queries.GetPatientNoShowCount(patient.UserID)
+	if err != nil {
+		response.ServerError(w, err.Error())
+		return
+	}
+
 	resp := queries.PatientDetailsResponse{
 		FirstName:         patient.User.FirstName,
 		LastName:          patient.User.LastName,
@@ -61,6 +67,59 @@ func GetPatientDetails(w http.ResponseWriter, r *http.Request) {
 		ChronicConditions: patient.ChronicConditions,
 		Allergies:         patient.Allergies,
 		Medications:       patient.Medications,
+		NoShowCount:       noShows,
+	}
+
+	response.Success(w, resp, "Patient details retrieved successfully")
+}
+
+// a dependent seen by the doctor, {id} is the guardian's user id
+func GetDependentDetails(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	if !ok {
+		response.Error(w, http.StatusUnauthorized, "Unauthorized")
+		return
+	}
+
+	vars := mux.Vars(r)
+	patientID, err := strconv.ParseUint(vars["id"], 10, 32)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid patient ID")
+		return
+	}
+	dependentID, err := strconv.ParseUint(vars["dependentId"], 10, 32)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid dependent ID")
+		return
+	}
+
+	dependent, err := queries.GetDoctorDependentDetails(claims.UserID, uint(patientID), uint(dependentID))
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	noShows, err := queries.GetDependentNoShowCount(dependent.ID)
+	if err != nil {
+		response.ServerError(w, err.Error())
+		return
+	}
+
+	resp := queries.PatientDetailsResponse{
+		FirstName:         dependent.FirstName,
+		LastName:          dependent.LastName,
+		Email:             dependent.Guardian.Email,
+		Image:             dependent.Guardian.Image,
+		Height:            dependent.Height,
+		Weight:            dependent.Weight,
+		BloodType:         dependent.BloodType,
+		ChronicConditions: dependent.ChronicConditions,
+		Allergies:         dependent.Allergies,
+		Medications:       dependent.Medications,
+		NoShowCount:       noShows,
+		DependentID:       &dependent.ID,
+		DateOfBirth:       &dependent.DateOfBirth,
+		GuardianName:      dependent.Guardian.FirstName + " " + dependent.Guardian.LastName,
 	}
 
 	response.Success(w, resp, "Patient details retrieved successfully")
@@ -0,0 +1,64 @@
+package doctor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+func GetRescheduleProposals(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	data, err := queries.GetRescheduleProposals(uint(id), queries.Actor{UserID: claims.UserID, Role: models.ActorDoctor})
+	if err != nil {
+		if errors.Is(err, queries.ErrAppointmentNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.ServerError(w, "Failed to fetch reschedule proposals")
+		return
+	}
+	response.Success(w, data, "Reschedule proposals retrieved")
+}
+
+func ProposeReschedule(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var req queries.RescheduleProposalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.ProposeReschedule(claims.UserID, uint(id), req)
+	if err != nil {
+		switch {
+		case errors.Is(err, queries.ErrAppointmentNotFound):
+			response.Error(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, queries.ErrSlotTaken), errors.Is(err, queries.ErrDoctorOnTimeOff), errors.Is(err, queries.ErrInvalidTransition):
+			response.Error(w, http.StatusConflict, err.Error())
+		default:
+			response.Error(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+	response.Success(w, data, "Reschedule proposed to the patient")
+}
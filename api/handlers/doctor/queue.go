@@ -0,0 +1,21 @@
+package doctor
+
+import (
+	"net/http"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+)
+
+func GetQueue(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.GetDoctorQueue(claims.UserID)
+	if err != nil {
+		response.ServerError(w, "Failed to fetch the waiting room queue")
+		return
+	}
+	response.Success(w, data, "Queue retrieved")
+}
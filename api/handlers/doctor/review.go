@@ -0,0 +1,84 @@
+package doctor
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+func GetReviews(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.GetDoctorReviews(claims.UserID)
+	if err != nil {
+		response.ServerError(w, "Failed to fetch reviews")
+		return
+	}
+	response.Success(w, data, "Reviews retrieved")
+}
+
+func ReplyToReview(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var body queries.ReviewReplyBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.ReplyToReview(claims.UserID, uint(id), body)
+	if err != nil {
+		switch {
+		case errors.Is(err, queries.ErrReviewNotFound):
+			response.Error(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, queries.ErrReviewNotPublished):
+			response.Error(w, http.StatusConflict, err.Error())
+		default:
+			response.Error(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+	response.Success(w, data, "Reply posted successfully")
+}
+
+func ReportReview(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var body queries.ReviewReportBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := queries.ReportReview(claims.UserID, uint(id), body); err != nil {
+		if errors.Is(err, queries.ErrReviewNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	response.Success(w, nil, "Review reported, an admin will look at it")
+}
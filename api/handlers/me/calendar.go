@@ -0,0 +1,35 @@
+package me
+
+import (
+	"net/http"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+)
+
+func GetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.GetCalendarFeed(claims.UserID)
+	if err != nil {
+		response.ServerError(w, "Failed to get calendar feed")
+		return
+	}
+
+	response.Success(w, data, "Calendar feed retrieved successfully")
+}
+
+// the old feed url stops working, for when it was shared by mistake
+func RotateCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	claims := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.RotateCalendarFeed(claims.UserID)
+	if err != nil {
+		response.ServerError(w, "Failed to rotate calendar feed")
+		return
+	}
+
+	response.Success(w, data, "Calendar feed rotated successfully")
+}
@@ -2,6 +2,7 @@ package me
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/YahiaJouini/careflow/api/middleware"
@@ -43,6 +44,10 @@ func UpdateUser(w http.ResponseWriter, r *http.Request) {
 
 	updatedUser, err := queries.UpdateUser(claims.UserID, body)
 	if err != nil {
+		if errors.Is(err, queries.ErrDoctorHasAppointments) {
+			response.Error(w, http.StatusConflict, err.Error())
+			return
+		}
 		response.Error(w, 0, err.Error())
 		return
 	}
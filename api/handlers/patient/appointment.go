@@ -2,13 +2,17 @@ package patient
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
 	"strconv"
 
 	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/models"
 	"github.com/YahiaJouini/careflow/internal/db/queries"
 	"github.com/YahiaJouini/careflow/pkg/auth"
 	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
 	"github.com/gorilla/mux"
 )
 
@@ -23,13 +27,50 @@ func CreateAppointment(w http.ResponseWriter, r *http.Request) {
 
 	data, err := queries.CreateAppointment(claims.UserID, req)
 	if err != nil {
-		response.Error(w, http.StatusBadRequest, err.Error())
+		switch {
+		case errors.Is(err, queries.ErrSlotTaken), errors.Is(err, queries.ErrDoctorOnTimeOff):
+			response.Error(w, http.StatusConflict, err.Error())
+		case errors.Is(err, queries.ErrBookingBlocked):
+			response.Error(w, http.StatusForbidden, err.Error())
+		default:
+			response.Error(w, http.StatusBadRequest, err.Error())
+		}
 		return
 	}
 
 	response.Success(w, data, "Appointment request sent successfully")
 }
 
+func CreateAppointmentSeries(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	var req queries.AppointmentSeriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.CreateAppointmentSeries(claims.UserID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, queries.ErrSlotTaken), errors.Is(err, queries.ErrDoctorOnTimeOff):
+			response.Error(w, http.StatusConflict, err.Error())
+		case errors.Is(err, queries.ErrBookingBlocked):
+			response.Error(w, http.StatusForbidden, err.Error())
+		default:
+			response.Error(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	response.Success(w, data, "Appointment series requested successfully")
+}
+
 func GetAppointments(w http.ResponseWriter, r *http.Request) {
 	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
 
@@ -53,9 +94,16 @@ func UpdateAppointment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	data, err := queries.UpdateAppointment(uint(id), claims.UserID, req)
+	data, err := queries.UpdateAppointment(uint(id), claims.UserID, req, r.URL.Query().Get("scope"))
 	if err != nil {
-		response.Error(w, http.StatusNotFound, err.Error())
+		switch {
+		case errors.Is(err, queries.ErrAppointmentNotFound):
+			response.Error(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, queries.ErrSlotTaken), errors.Is(err, queries.ErrDoctorOnTimeOff), errors.Is(err, queries.ErrNotMovable):
+			response.Error(w, http.StatusConflict, err.Error())
+		default:
+			response.Error(w, http.StatusBadRequest, err.Error())
+		}
 		return
 	}
 
@@ -67,15 +115,48 @@ func CancelAppointment(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, _ := strconv.Atoi(vars["id"])
 
-	err := queries.CancelAppointment(uint(id), claims.UserID)
+	var req queries.CancelAppointmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	tooLate, err := queries.CancelAppointment(uint(id), claims.UserID, req, r.URL.Query().Get("scope"))
 	if err != nil {
-		response.Error(w, http.StatusNotFound, "Appointment not found or unauthorized")
+		if errors.Is(err, queries.ErrAppointmentNotFound) {
+			response.Error(w, http.StatusNotFound, "Appointment not found or unauthorized")
+			return
+		}
+		response.Error(w, http.StatusConflict, err.Error())
 		return
 	}
 
+	if len(tooLate) > 0 {
+		response.Success(w, map[string][]uint{"keptAppointmentIds": tooLate}, "Appointments cancelled, the ones inside the notice window were kept, please contact the doctor for them")
+		return
+	}
 	response.Success(w, nil, "Appointment cancelled successfully")
 }
 
+func GetAppointmentHistory(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	data, err := queries.GetAppointmentHistory(uint(id), queries.Actor{UserID: claims.UserID, Role: models.ActorPatient})
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Appointment history retrieved successfully")
+}
+
 func GetMedicalHistory(w http.ResponseWriter, r *http.Request) {
 	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
 
@@ -101,3 +182,38 @@ func DeleteAppointment(w http.ResponseWriter, r *http.Request) {
 
 	response.Success(w, nil, "Appointment deleted successfully")
 }
+
+func DownloadAppointmentCalendar(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	calendar, err := queries.GetAppointmentCalendar(uint(id), queries.Actor{UserID: claims.UserID, Role: models.ActorPatient})
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response.Calendar(w, calendar, fmt.Sprintf("appointment-%d.ics", id))
+}
+
+func CheckInAppointment(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	data, err := queries.CheckInAppointment(uint(id), claims.UserID)
+	if err != nil {
+		switch {
+		case errors.Is(err, queries.ErrAppointmentNotFound):
+			response.Error(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, queries.ErrInvalidTransition):
+			response.Error(w, http.StatusConflict, err.Error())
+		default:
+			response.Error(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	response.Success(w, data, "Checked in successfully")
+}
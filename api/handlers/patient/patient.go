@@ -2,6 +2,7 @@ package patient
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/YahiaJouini/careflow/api/middleware"
@@ -40,6 +41,10 @@ func UpdatePatient(w http.ResponseWriter, r *http.Request) {
 
 	updatedPatient, err := queries.UpdatePatient(claims.UserID, body)
 	if err != nil {
+		if errors.Is(err, queries.ErrInsuranceProviderNotFound) {
+			response.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		response.Error(w, http.StatusInternalServerError, err.Error())
 		return
 	}
@@ -0,0 +1,93 @@
+package patient
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+func GetRescheduleProposals(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	data, err := queries.GetRescheduleProposals(uint(id), queries.Actor{UserID: claims.UserID, Role: models.ActorPatient})
+	if err != nil {
+		if errors.Is(err, queries.ErrAppointmentNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.ServerError(w, "Failed to retrieve reschedule proposals")
+		return
+	}
+
+	response.Success(w, data, "Reschedule proposals retrieved successfully")
+}
+
+func AcceptRescheduleProposal(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	var req queries.AcceptProposalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.AcceptRescheduleProposal(uint(id), claims.UserID, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, queries.ErrAppointmentNotFound), errors.Is(err, queries.ErrNoOpenProposal):
+			response.Error(w, http.StatusNotFound, err.Error())
+		case errors.Is(err, queries.ErrSlotTaken), errors.Is(err, queries.ErrDoctorOnTimeOff):
+			response.Error(w, http.StatusConflict, err.Error())
+		default:
+			response.Error(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	response.Success(w, data, "Proposed time accepted successfully")
+}
+
+func DeclineRescheduleProposal(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	// the reason is optional so an empty body is fine
+	var req queries.DeclineProposalRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	err := queries.DeclineRescheduleProposal(uint(id), claims.UserID, req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, queries.ErrAppointmentNotFound), errors.Is(err, queries.ErrNoOpenProposal):
+			response.Error(w, http.StatusNotFound, err.Error())
+		default:
+			response.Error(w, http.StatusBadRequest, err.Error())
+		}
+		return
+	}
+
+	response.Success(w, nil, "Proposal declined, the appointment was cancelled")
+}
@@ -0,0 +1,87 @@
+package patient
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+func GetReviews(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.GetPatientReviews(claims.UserID)
+	if err != nil {
+		response.ServerError(w, "Failed to retrieve reviews")
+		return
+	}
+
+	response.Success(w, data, "Reviews retrieved successfully")
+}
+
+func decodeReview(w http.ResponseWriter, r *http.Request) (*queries.ReviewBody, bool) {
+	var body queries.ReviewBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return nil, false
+	}
+
+	if err := utils.Validate.Struct(body); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	return &body, true
+}
+
+func reviewError(w http.ResponseWriter, err error) {
+	if errors.Is(err, queries.ErrAppointmentNotFound) || errors.Is(err, queries.ErrReviewNotFound) {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+	response.Error(w, http.StatusBadRequest, err.Error())
+}
+
+func CreateReview(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	body, ok := decodeReview(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := queries.CreateReview(claims.UserID, uint(id), *body)
+	if err != nil {
+		reviewError(w, err)
+		return
+	}
+
+	response.Success(w, data, "Review posted successfully")
+}
+
+func UpdateReview(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	body, ok := decodeReview(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := queries.UpdateReview(claims.UserID, uint(id), *body)
+	if err != nil {
+		reviewError(w, err)
+		return
+	}
+
+	response.Success(w, data, "Review updated successfully")
+}
@@ -0,0 +1,103 @@
+package patient
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/YahiaJouini/careflow/api/middleware"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
+)
+
+func JoinWaitlist(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	var req queries.WaitlistRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid request body")
+		return
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.JoinWaitlist(claims.UserID, req)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Added to the waitlist successfully")
+}
+
+func GetWaitlist(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+
+	data, err := queries.GetPatientWaitlist(claims.UserID)
+	if err != nil {
+		response.ServerError(w, "Failed to retrieve waitlist")
+		return
+	}
+
+	response.Success(w, data, "Waitlist retrieved successfully")
+}
+
+func waitlistError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, queries.ErrWaitlistEntryNotFound):
+		response.Error(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, queries.ErrSlotTaken):
+		response.Error(w, http.StatusConflict, err.Error())
+	case errors.Is(err, queries.ErrBookingBlocked):
+		response.Error(w, http.StatusForbidden, err.Error())
+	default:
+		response.Error(w, http.StatusBadRequest, err.Error())
+	}
+}
+
+func AcceptWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	data, err := queries.AcceptWaitlistOffer(claims.UserID, uint(id))
+	if err != nil {
+		waitlistError(w, err)
+		return
+	}
+
+	response.Success(w, data, "Offer accepted, appointment requested successfully")
+}
+
+func DeclineWaitlistOffer(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	if err := queries.DeclineWaitlistOffer(claims.UserID, uint(id)); err != nil {
+		waitlistError(w, err)
+		return
+	}
+
+	response.Success(w, nil, "Offer declined")
+}
+
+func LeaveWaitlist(w http.ResponseWriter, r *http.Request) {
+	claims, _ := r.Context().Value(middleware.UserClaimsKey).(*auth.Claims)
+	vars := mux.Vars(r)
+	id, _ := strconv.Atoi(vars["id"])
+
+	if err := queries.LeaveWaitlist(claims.UserID, uint(id)); err != nil {
+		waitlistError(w, err)
+		return
+	}
+
+	response.Success(w, nil, "Removed from the waitlist")
+}
@@ -0,0 +1,27 @@
+package public
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/gorilla/mux"
+)
+
+// subscribable feed, the secret token in the url is the only authentication
+func GetCalendarFeed(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	calendar, err := queries.GetCalendarByFeedToken(vars["token"])
+	if err != nil {
+		if errors.Is(err, queries.ErrCalendarFeedNotFound) {
+			response.Error(w, http.StatusNotFound, err.Error())
+			return
+		}
+		response.ServerError(w, "Failed to build calendar feed")
+		return
+	}
+
+	response.Calendar(w, calendar, "")
+}
@@ -1,17 +1,180 @@
 package public
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/YahiaJouini/careflow/internal/db/queries"
 	"github.com/YahiaJouini/careflow/pkg/response"
+	"github.com/YahiaJouini/careflow/pkg/utils"
+	"github.com/gorilla/mux"
 )
 
+const maxSlotsRange = 31 * 24 * time.Hour
+
+// radius of the nearby search when none is given, and the largest one accepted
+const (
+	defaultRadiusKm = 25
+	maxRadiusKm     = 500
+)
+
+// reads the optional lat, lng and radiusKm parameters of the nearby search
+func parseNearby(query url.Values, filter *queries.PublicDoctorFilter) error {
+	lat, lng := query.Get("lat"), query.Get("lng")
+	if lat == "" && lng == "" {
+		if query.Get("radiusKm") != "" {
+			return errors.New("radiusKm needs lat and lng")
+		}
+		return nil
+	}
+
+	latitude, err := strconv.ParseFloat(lat, 64)
+	if err != nil || latitude < -90 || latitude > 90 {
+		return errors.New("Invalid lat")
+	}
+	longitude, err := strconv.ParseFloat(lng, 64)
+	if err != nil || longitude < -180 || longitude > 180 {
+		return errors.New("Invalid lng")
+	}
+
+	filter.Near = &queries.GeoPoint{Latitude: latitude, Longitude: longitude}
+	filter.RadiusKm = defaultRadiusKm
+	if value := query.Get("radiusKm"); value != "" {
+		radius, err := strconv.ParseFloat(value, 64)
+		if err != nil || radius <= 0 || radius > maxRadiusKm {
+			return fmt.Errorf("radiusKm must be between 0 and %d", maxRadiusKm)
+		}
+		filter.RadiusKm = radius
+	}
+	return nil
+}
+
+const defaultSearchPageSize = 20
+
+func parseFloatParam(query url.Values, name string) (*float64, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return nil, errors.New("Invalid " + name)
+	}
+	return &parsed, nil
+}
+
+func parseBoolParam(query url.Values, name string) (*bool, error) {
+	value := query.Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	parsed, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, errors.New("Invalid " + name)
+	}
+	return &parsed, nil
+}
+
+func parseIntParam(query url.Values, name string, fallback int) (int, error) {
+	value := query.Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, errors.New("Invalid " + name)
+	}
+	return parsed, nil
+}
+
+func parseDoctorSearch(query url.Values) (queries.DoctorSearchRequest, error) {
+	req := queries.DoctorSearchRequest{
+		Query: strings.TrimSpace(query.Get("q")),
+		Sort:  query.Get("sort"),
+	}
+
+	specialtyID, err := parseIntParam(query, "specialtyId", 0)
+	if err != nil {
+		return req, err
+	}
+	req.SpecialtyID = uint(specialtyID)
+
+	if req.MinFee, err = parseFloatParam(query, "minFee"); err != nil {
+		return req, err
+	}
+	if req.MaxFee, err = parseFloatParam(query, "maxFee"); err != nil {
+		return req, err
+	}
+	if req.Available, err = parseBoolParam(query, "available"); err != nil {
+		return req, err
+	}
+	if req.Page, err = parseIntParam(query, "page", 1); err != nil {
+		return req, err
+	}
+	if req.PageSize, err = parseIntParam(query, "pageSize", defaultSearchPageSize); err != nil {
+		return req, err
+	}
+
+	if err := parseProfileFilters(query, &req.PublicDoctorFilter); err != nil {
+		return req, err
+	}
+	return req, parseNearby(query, &req.PublicDoctorFilter)
+}
+
+// paginated search on name, specialty and bio with filters and sorting
+func SearchDoctors(w http.ResponseWriter, r *http.Request) {
+	req, err := parseDoctorSearch(r.URL.Query())
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := utils.Validate.Struct(req); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	data, err := queries.SearchDoctors(req)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Doctors retrieved successfully")
+}
+
+// reads the optional language (comma separated codes), minExperience and insuranceId parameters
+func parseProfileFilters(query url.Values, filter *queries.PublicDoctorFilter) error {
+	if value := query.Get("language"); value != "" {
+		for _, language := range strings.Split(value, ",") {
+			if language = strings.ToLower(strings.TrimSpace(language)); language != "" {
+				filter.Languages = append(filter.Languages, language)
+			}
+		}
+	}
+
+	minExperience, err := parseIntParam(query, "minExperience", 0)
+	if err != nil || minExperience < 0 {
+		return errors.New("Invalid minExperience")
+	}
+	filter.MinExperience = minExperience
+
+	insuranceID, err := parseIntParam(query, "insuranceId", 0)
+	if err != nil || insuranceID < 0 {
+		return errors.New("Invalid insuranceId")
+	}
+	filter.InsuranceProviderID = uint(insuranceID)
+	return nil
+}
+
 func GetDoctors(w http.ResponseWriter, r *http.Request) {
 	queryParam := r.URL.Query().Get("specialtyId")
-	var specialtyID uint
+	var filter queries.PublicDoctorFilter
 
 	if queryParam != "" {
 		id, err := strconv.Atoi(queryParam)
@@ -19,12 +182,30 @@ func GetDoctors(w http.ResponseWriter, r *http.Request) {
 			response.Error(w, http.StatusBadRequest, "Invalid specialityId")
 			return
 		}
-		specialtyID = uint(id)
+		filter.SpecialtyID = uint(id)
+	}
+
+	// doctors near the patient come nearest first, with their distance
+	if err := parseNearby(r.URL.Query(), &filter); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	fmt.Println("Fetching doctors with specialty ID:", specialtyID)
+	if err := parseProfileFilters(r.URL.Query(), &filter); err != nil {
+		response.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-	data, err := queries.GetPublicDoctors(specialtyID)
+	switch r.URL.Query().Get("sort") {
+	case "":
+	case queries.SortRating:
+		filter.ByRating = true
+	default:
+		response.Error(w, http.StatusBadRequest, "Invalid sort. Use 'rating'")
+		return
+	}
+
+	data, err := queries.GetPublicDoctors(filter)
 	if err != nil {
 		response.ServerError(w, "Failed to fetch doctors")
 		return
@@ -32,3 +213,152 @@ func GetDoctors(w http.ResponseWriter, r *http.Request) {
 
 	response.Success(w, data, "Doctors retrieved successfully")
 }
+
+// number of open slots shown on a profile unless ?slots= asks for another one
+const (
+	defaultProfileSlots = 5
+	maxProfileSlots     = 20
+)
+
+func GetDoctor(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	slots, err := parseIntParam(r.URL.Query(), "slots", defaultProfileSlots)
+	if err != nil || slots < 0 || slots > maxProfileSlots {
+		response.Error(w, http.StatusBadRequest, fmt.Sprintf("slots must be between 0 and %d", maxProfileSlots))
+		return
+	}
+
+	data, err := queries.GetPublicDoctorProfile(uint(id), slots)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Doctor retrieved successfully")
+}
+
+// published reviews of the doctor, newest first
+func GetDoctorReviews(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	query := r.URL.Query()
+	page, err := parseIntParam(query, "page", 1)
+	if err != nil || page < 1 {
+		response.Error(w, http.StatusBadRequest, "Invalid page")
+		return
+	}
+	pageSize, err := parseIntParam(query, "pageSize", defaultSearchPageSize)
+	if err != nil || pageSize < 1 || pageSize > 50 {
+		response.Error(w, http.StatusBadRequest, "pageSize must be between 1 and 50")
+		return
+	}
+
+	data, err := queries.GetPublicReviews(uint(id), page, pageSize)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Reviews retrieved successfully")
+}
+
+// accepts either a full RFC3339 timestamp or a plain YYYY-MM-DD date, read in loc
+func parseTimeParam(value string, fallback time.Time, loc *time.Location) (time.Time, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, loc)
+}
+
+func GetDoctorSlots(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	// plain dates are days of the doctor's practice
+	loc := queries.DoctorLocation(uint(id))
+	query := r.URL.Query()
+	from, err := parseTimeParam(query.Get("from"), time.Now(), loc)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid 'from' date")
+		return
+	}
+	to, err := parseTimeParam(query.Get("to"), from.AddDate(0, 0, 7), loc)
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid 'to' date")
+		return
+	}
+
+	if !to.After(from) {
+		response.Error(w, http.StatusBadRequest, "'to' must be after 'from'")
+		return
+	}
+	if to.Sub(from) > maxSlotsRange {
+		response.Error(w, http.StatusBadRequest, "Date range cannot exceed 31 days")
+		return
+	}
+
+	var appointmentTypeID *uint
+	if value := query.Get("appointmentTypeId"); value != "" {
+		typeID, err := strconv.Atoi(value)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid appointmentTypeId")
+			return
+		}
+		parsed := uint(typeID)
+		appointmentTypeID = &parsed
+	}
+
+	var locationID *uint
+	if value := query.Get("locationId"); value != "" {
+		parsedID, err := strconv.Atoi(value)
+		if err != nil {
+			response.Error(w, http.StatusBadRequest, "Invalid locationId")
+			return
+		}
+		parsed := uint(parsedID)
+		locationID = &parsed
+	}
+
+	data, err := queries.GetAvailableSlots(uint(id), from, to, appointmentTypeID, locationID)
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Available slots retrieved successfully")
+}
+
+func GetDoctorAppointmentTypes(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		response.Error(w, http.StatusBadRequest, "Invalid ID")
+		return
+	}
+
+	data, err := queries.GetPublicAppointmentTypes(uint(id))
+	if err != nil {
+		response.Error(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	response.Success(w, data, "Appointment types retrieved successfully")
+}
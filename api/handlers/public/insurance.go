@@ -0,0 +1,18 @@
+package public
+
+import (
+	"net/http"
+
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/response"
+)
+
+func GetInsuranceProviders(w http.ResponseWriter, r *http.Request) {
+	data, err := queries.GetInsuranceProviders(true)
+	if err != nil {
+		response.ServerError(w, "Failed to fetch insurance providers")
+		return
+	}
+
+	response.Success(w, data, "Insurance providers retrieved successfully")
+}
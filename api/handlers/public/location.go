@@ -0,0 +1,18 @@
+package public
+
+import (
+	"net/http"
+
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/response"
+)
+
+func GetLocations(w http.ResponseWriter, r *http.Request) {
+	data, err := queries.GetLocations(r.URL.Query().Get("city"))
+	if err != nil {
+		response.ServerError(w, "Failed to fetch locations")
+		return
+	}
+
+	response.Success(w, data, "Locations retrieved successfully")
+}
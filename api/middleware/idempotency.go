@@ -0,0 +1,168 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/config"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/response"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// how long a response is kept for replays unless IDEMPOTENCY_WINDOW is set (e.g. "12h")
+const defaultIdempotencyWindow = 24 * time.Hour
+
+// largest body an idempotent request may have
+const maxIdempotentBody = 1 << 20
+
+// where the keys are stored, replaced in tests
+var (
+	claimIdempotencyKey    = queries.ClaimIdempotencyKey
+	saveIdempotentResponse = queries.SaveIdempotentResponse
+	deleteIdempotencyKey   = queries.ReleaseIdempotencyKey
+)
+
+// passes the response through while keeping a copy of it
+type recordingWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *recordingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func idempotencyWindow() time.Duration {
+	value, err := config.GetEnv("IDEMPOTENCY_WINDOW")
+	if err != nil {
+		return defaultIdempotencyWindow
+	}
+	window, err := time.ParseDuration(value)
+	if err != nil || window <= 0 {
+		return defaultIdempotencyWindow
+	}
+	return window
+}
+
+// a key can only be replayed for the same method, path and body
+func requestHash(method string, path string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + path + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+func releaseIdempotencyKey(recordID uint) {
+	if err := deleteIdempotencyKey(recordID); err != nil {
+		log.Println("failed to release idempotency key", recordID, err)
+	}
+}
+
+// anonymous callers all share user 0, their key is mixed with the request so that two
+// clients picking the same key only share a response when they sent the very same request
+func anonymousKey(key string, hash string) string {
+	scoped := sha256.Sum256([]byte(key + "\n" + hash))
+	return hex.EncodeToString(scoped[:])
+}
+
+// stores the first response of a request sent with an Idempotency-Key header and replays it
+// when the client retries with the same key. Requests without the header run as usual.
+// Put it after AuthMiddleware so keys are scoped to the user
+func Idempotency() func(http.Handler) http.Handler {
+	window := idempotencyWindow()
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > 255 {
+				response.Error(w, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+			if err != nil || len(body) > maxIdempotentBody {
+				response.Error(w, http.StatusBadRequest, "Invalid request body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			hash := requestHash(r.Method, r.URL.Path, body)
+			var userID uint
+			if claims, ok := r.Context().Value(UserClaimsKey).(*auth.Claims); ok {
+				userID = claims.UserID
+			}
+			if userID == 0 {
+				key = anonymousKey(key, hash)
+			}
+
+			record, claimed, err := claimIdempotencyKey(userID, key, hash, window)
+			if err != nil {
+				switch {
+				case errors.Is(err, queries.ErrIdempotencyKeyReused):
+					response.Error(w, http.StatusUnprocessableEntity, err.Error())
+				case errors.Is(err, queries.ErrIdempotencyKeyInProgress):
+					response.Error(w, http.StatusConflict, err.Error())
+				default:
+					response.ServerError(w)
+				}
+				return
+			}
+
+			if !claimed {
+				if record.ContentType != "" {
+					w.Header().Set("Content-Type", record.ContentType)
+				}
+				w.Header().Set("Idempotent-Replayed", "true")
+				w.WriteHeader(record.StatusCode)
+				w.Write(record.Body)
+				return
+			}
+
+			// a panicking handler must not leave the key locked
+			defer func() {
+				if p := recover(); p != nil {
+					releaseIdempotencyKey(record.ID)
+					panic(p)
+				}
+			}()
+
+			recorder := &recordingWriter{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			// server errors are not kept, the client may retry them
+			if recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+				releaseIdempotencyKey(record.ID)
+				return
+			}
+			err = saveIdempotentResponse(record.ID, recorder.status, w.Header().Get("Content-Type"), recorder.body.Bytes())
+			if err != nil {
+				log.Println("failed to save idempotent response", record.ID, err)
+				// a retry would otherwise wait for the lease to run out
+				releaseIdempotencyKey(record.ID)
+			}
+		})
+	}
+}
@@ -0,0 +1,288 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+)
+
+// in memory stand-in for the idempotency table
+type memoryIdempotencyStore struct {
+	records  map[string]*models.IdempotencyRecord
+	nextID   uint
+	released int
+	claimErr error
+	saveErr  error
+}
+
+func useMemoryIdempotencyStore(t *testing.T) *memoryIdempotencyStore {
+	store := &memoryIdempotencyStore{records: map[string]*models.IdempotencyRecord{}}
+
+	claim, save, release := claimIdempotencyKey, saveIdempotentResponse, deleteIdempotencyKey
+	t.Cleanup(func() {
+		claimIdempotencyKey, saveIdempotentResponse, deleteIdempotencyKey = claim, save, release
+	})
+
+	claimIdempotencyKey = store.claim
+	saveIdempotentResponse = store.save
+	deleteIdempotencyKey = store.release
+	return store
+}
+
+func (s *memoryIdempotencyStore) claim(userID uint, key string, requestHash string, window time.Duration) (*models.IdempotencyRecord, bool, error) {
+	if s.claimErr != nil {
+		return nil, false, s.claimErr
+	}
+
+	existing, ok := s.records[storeKey(userID, key)]
+	if !ok {
+		s.nextID++
+		record := &models.IdempotencyRecord{ID: s.nextID, UserID: userID, Key: key, RequestHash: requestHash}
+		s.records[storeKey(userID, key)] = record
+		return record, true, nil
+	}
+	if existing.RequestHash != requestHash {
+		return nil, false, queries.ErrIdempotencyKeyReused
+	}
+	if !existing.Completed {
+		return nil, false, queries.ErrIdempotencyKeyInProgress
+	}
+	return existing, false, nil
+}
+
+func (s *memoryIdempotencyStore) save(recordID uint, statusCode int, contentType string, body []byte) error {
+	if s.saveErr != nil {
+		return s.saveErr
+	}
+	for _, record := range s.records {
+		if record.ID == recordID {
+			record.Completed = true
+			record.StatusCode = statusCode
+			record.ContentType = contentType
+			record.Body = body
+		}
+	}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) release(recordID uint) error {
+	s.released++
+	for key, record := range s.records {
+		if record.ID == recordID {
+			delete(s.records, key)
+		}
+	}
+	return nil
+}
+
+func (s *memoryIdempotencyStore) seed(record *models.IdempotencyRecord) {
+	s.records[storeKey(record.UserID, record.Key)] = record
+}
+
+// the unique index of the table is on user and key
+func storeKey(userID uint, key string) string {
+	return fmt.Sprint(userID, "/", key)
+}
+
+type idempotentRequest struct {
+	// 0 for an anonymous caller
+	userID uint
+	key    string
+	body   string
+}
+
+func TestIdempotency(t *testing.T) {
+	created := func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"echo":"` + string(body) + `"}`))
+	}
+	failing := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		seed      *models.IdempotencyRecord
+		claimErr  error
+		saveErr   error
+		requests  []idempotentRequest
+		want      []int
+		wantCalls int
+		// record ids given back, so a retry runs the handler again
+		wantReleased int
+	}{
+		{
+			name:      "no key runs every request",
+			handler:   created,
+			requests:  []idempotentRequest{{1, "", "a"}, {1, "", "a"}},
+			want:      []int{http.StatusCreated, http.StatusCreated},
+			wantCalls: 2,
+		},
+		{
+			name:      "retry is replayed",
+			handler:   created,
+			requests:  []idempotentRequest{{1, "k1", "a"}, {1, "k1", "a"}},
+			want:      []int{http.StatusCreated, http.StatusCreated},
+			wantCalls: 1,
+		},
+		{
+			name:      "other keys run again",
+			handler:   created,
+			requests:  []idempotentRequest{{1, "k1", "a"}, {1, "k2", "a"}},
+			want:      []int{http.StatusCreated, http.StatusCreated},
+			wantCalls: 2,
+		},
+		{
+			name:      "key reused for another body",
+			handler:   created,
+			requests:  []idempotentRequest{{1, "k1", "a"}, {1, "k1", "b"}},
+			want:      []int{http.StatusCreated, http.StatusUnprocessableEntity},
+			wantCalls: 1,
+		},
+		{
+			name:     "key of a request still running",
+			handler:  created,
+			seed:     &models.IdempotencyRecord{ID: 99, UserID: 1, Key: "k1", RequestHash: requestHash(http.MethodPost, "/appointments", []byte("a"))},
+			requests: []idempotentRequest{{1, "k1", "a"}},
+			want:     []int{http.StatusConflict},
+		},
+		{
+			name:         "server errors are not kept",
+			handler:      failing,
+			requests:     []idempotentRequest{{1, "k1", "a"}, {1, "k1", "a"}},
+			want:         []int{http.StatusInternalServerError, http.StatusInternalServerError},
+			wantCalls:    2,
+			wantReleased: 2,
+		},
+		{
+			name:      "same key from other users runs again",
+			handler:   created,
+			requests:  []idempotentRequest{{1, "k1", "a"}, {2, "k1", "a"}},
+			want:      []int{http.StatusCreated, http.StatusCreated},
+			wantCalls: 2,
+		},
+		{
+			name:      "anonymous retry is replayed",
+			handler:   created,
+			requests:  []idempotentRequest{{0, "k1", "a"}, {0, "k1", "a"}},
+			want:      []int{http.StatusCreated, http.StatusCreated},
+			wantCalls: 1,
+		},
+		{
+			// two anonymous clients picking the same key must not get each other's response
+			name:      "anonymous key shared by other requests",
+			handler:   created,
+			requests:  []idempotentRequest{{0, "k1", "a"}, {0, "k1", "b"}},
+			want:      []int{http.StatusCreated, http.StatusCreated},
+			wantCalls: 2,
+		},
+		{
+			name:      "key too long",
+			handler:   created,
+			requests:  []idempotentRequest{{1, strings.Repeat("k", 256), "a"}},
+			want:      []int{http.StatusBadRequest},
+			wantCalls: 0,
+		},
+		{
+			name:     "storage down",
+			handler:  created,
+			claimErr: errors.New("connection refused"),
+			requests: []idempotentRequest{{1, "k1", "a"}},
+			want:     []int{http.StatusInternalServerError},
+		},
+		{
+			name:         "response that could not be saved is released",
+			handler:      created,
+			saveErr:      errors.New("connection refused"),
+			requests:     []idempotentRequest{{1, "k1", "a"}, {1, "k1", "a"}},
+			want:         []int{http.StatusCreated, http.StatusCreated},
+			wantCalls:    2,
+			wantReleased: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := useMemoryIdempotencyStore(t)
+			store.claimErr, store.saveErr = tt.claimErr, tt.saveErr
+			if tt.seed != nil {
+				store.seed(tt.seed)
+			}
+
+			calls := 0
+			handler := Idempotency()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				calls++
+				tt.handler(w, r)
+			}))
+
+			var firstBody string
+			for i, req := range tt.requests {
+				r := httptest.NewRequest(http.MethodPost, "/appointments", strings.NewReader(req.body))
+				if req.key != "" {
+					r.Header.Set(IdempotencyKeyHeader, req.key)
+				}
+				if req.userID != 0 {
+					r = r.WithContext(context.WithValue(r.Context(), UserClaimsKey, &auth.Claims{UserID: req.userID}))
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, r)
+
+				if w.Code != tt.want[i] {
+					t.Errorf("request %d: status %d, want %d", i, w.Code, tt.want[i])
+				}
+				if i == 0 {
+					firstBody = w.Body.String()
+				} else if w.Header().Get("Idempotent-Replayed") == "true" {
+					if w.Body.String() != firstBody {
+						t.Errorf("replayed body %q, want %q", w.Body.String(), firstBody)
+					}
+					if w.Header().Get("Content-Type") != "application/json" {
+						t.Errorf("replayed content type %q", w.Header().Get("Content-Type"))
+					}
+				}
+			}
+
+			if calls != tt.wantCalls {
+				t.Errorf("handler ran %d times, want %d", calls, tt.wantCalls)
+			}
+			if store.released != tt.wantReleased {
+				t.Errorf("%d keys released, want %d", store.released, tt.wantReleased)
+			}
+		})
+	}
+}
+
+func TestIdempotencyReleasesKeyOnPanic(t *testing.T) {
+	store := useMemoryIdempotencyStore(t)
+	handler := Idempotency()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("the panic was swallowed")
+			}
+		}()
+		r := httptest.NewRequest(http.MethodPost, "/appointments", strings.NewReader("a"))
+		r.Header.Set(IdempotencyKeyHeader, "k1")
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}()
+
+	if store.released != 1 || len(store.records) != 0 {
+		t.Errorf("key not released after a panic: %d released, %d records left", store.released, len(store.records))
+	}
+}
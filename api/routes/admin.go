@@ -1,17 +1,30 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/YahiaJouini/careflow/api/handlers/admin"
+	"github.com/YahiaJouini/careflow/api/middleware"
 	"github.com/gorilla/mux"
 )
 
 func InitAdminRoutes(router *mux.Router) {
 	// specialities
-	router.HandleFunc("/specialties", admin.CreateSpecialty).Methods("POST")
+	router.Handle("/specialties", middleware.Idempotency()(http.HandlerFunc(admin.CreateSpecialty))).Methods("POST")
 	router.HandleFunc("/specialties", admin.GetAllSpecialties).Methods("GET")
 	router.HandleFunc("/specialties/{id}", admin.UpdateSpecialty).Methods("PUT")
 	router.HandleFunc("/specialties/{id}", admin.DeleteSpecialty).Methods("DELETE")
 
+	// insurance catalog
+	router.HandleFunc("/insurance-providers", admin.GetInsuranceProviders).Methods("GET")
+	router.HandleFunc("/insurance-providers", admin.CreateInsuranceProvider).Methods("POST")
+	router.HandleFunc("/insurance-providers/{id}", admin.UpdateInsuranceProvider).Methods("PUT")
+	router.HandleFunc("/insurance-providers/{id}", admin.DeleteInsuranceProvider).Methods("DELETE")
+
+	// locations
+	router.HandleFunc("/locations", admin.GetLocations).Methods("GET")
+	router.HandleFunc("/locations/{id}", admin.UpdateLocation).Methods("PUT")
+
 	// user management
 	router.HandleFunc("/users", admin.CreateUser).Methods("POST")
 	router.HandleFunc("/users", admin.GetAllUsers).Methods("GET")
@@ -19,6 +32,17 @@ func InitAdminRoutes(router *mux.Router) {
 	router.HandleFunc("/users/{id}/role", admin.UpdateUserRole).Methods("PUT")
 	router.HandleFunc("/doctors/{id}/verify", admin.VerifyDoctor).Methods("PUT")
 
+	// appointments
+	router.HandleFunc("/appointments/{id}/history", admin.GetAppointmentHistory).Methods("GET")
+
+	// reviews
+	router.HandleFunc("/reviews", admin.GetReviewQueue).Methods("GET")
+	router.HandleFunc("/reviews/{id}/moderate", admin.ModerateReview).Methods("PUT")
+
+	// booking rules
+	router.HandleFunc("/booking-policy", admin.GetBookingPolicy).Methods("GET")
+	router.HandleFunc("/booking-policy", admin.UpdateBookingPolicy).Methods("PUT")
+
 	// statistics
 	router.HandleFunc("/stats", admin.GetDashboardOverview).Methods("GET")
 }
@@ -10,7 +10,7 @@ import (
 
 func InitAuthRoutes(router *mux.Router) {
 	router.HandleFunc("/login", auth.Login).Methods("POST")
-	router.HandleFunc("/register", auth.Register).Methods("POST")
+	router.Handle("/register", middleware.Idempotency()(http.HandlerFunc(auth.Register))).Methods("POST")
 	router.HandleFunc("/verify-email", auth.ValidateCode).Methods("POST")
 	router.HandleFunc("/resend-verification", auth.ResendCode).Methods("POST")
 	router.HandleFunc("/google-login", auth.GoogleLogin).Methods("POST")
@@ -8,13 +8,55 @@ import (
 func InitDoctorRoutes(router *mux.Router) {
 	router.HandleFunc("/stats", doctor.GetDashboardOverview).Methods("GET")
 
+	// working hours
+	router.HandleFunc("/schedule", doctor.GetSchedule).Methods("GET")
+	router.HandleFunc("/schedule", doctor.UpdateSchedule).Methods("PUT")
+	router.HandleFunc("/time-off", doctor.GetTimeOff).Methods("GET")
+	router.HandleFunc("/time-off", doctor.CreateTimeOff).Methods("POST")
+	router.HandleFunc("/time-off/{id}", doctor.DeleteTimeOff).Methods("DELETE")
+
+	// practice locations, shared between the doctors working there
+	router.HandleFunc("/locations", doctor.GetLocations).Methods("GET")
+	router.HandleFunc("/locations", doctor.CreateLocation).Methods("POST")
+	router.HandleFunc("/locations/{id}/attach", doctor.AttachLocation).Methods("POST")
+	router.HandleFunc("/locations/{id}", doctor.UpdateLocation).Methods("PUT")
+	router.HandleFunc("/locations/{id}", doctor.DetachLocation).Methods("DELETE")
+
+	// insurers whose patients the doctor accepts
+	router.HandleFunc("/insurance-providers", doctor.GetInsuranceProviders).Methods("GET")
+	router.HandleFunc("/insurance-providers", doctor.UpdateInsuranceProviders).Methods("PUT")
+
+	// external calendar
+	router.HandleFunc("/calendar-sync", doctor.GetCalendarSync).Methods("GET")
+	router.HandleFunc("/calendar-sync", doctor.UpdateCalendarSync).Methods("PUT")
+	router.HandleFunc("/calendar-sync", doctor.DeleteCalendarSync).Methods("DELETE")
+	router.HandleFunc("/calendar-sync/run", doctor.RunCalendarSync).Methods("POST")
+
+	// appointment types
+	router.HandleFunc("/appointment-types", doctor.GetAppointmentTypes).Methods("GET")
+	router.HandleFunc("/appointment-types", doctor.CreateAppointmentType).Methods("POST")
+	router.HandleFunc("/appointment-types/{id}", doctor.UpdateAppointmentType).Methods("PUT")
+	router.HandleFunc("/appointment-types/{id}", doctor.DeleteAppointmentType).Methods("DELETE")
+
 	// appointments routes
 	router.HandleFunc("/appointments", doctor.GetAppointments).Methods("GET")
+	// today's waiting room, patients are checked in and taken in through /appointments/{id}/validate
+	router.HandleFunc("/queue", doctor.GetQueue).Methods("GET")
+	router.HandleFunc("/appointments/{id}/history", doctor.GetAppointmentHistory).Methods("GET")
+	router.HandleFunc("/appointments/{id}/ics", doctor.DownloadAppointmentCalendar).Methods("GET")
+	router.HandleFunc("/appointments/{id}/proposals", doctor.GetRescheduleProposals).Methods("GET")
+	router.HandleFunc("/appointments/{id}/proposals", doctor.ProposeReschedule).Methods("POST")
 	router.HandleFunc("/appointments/{id}/validate", doctor.ValidateAppointment).Methods("PUT")
 	router.HandleFunc("/appointments/{id}", doctor.UpdateAppointment).Methods("PUT")
 	router.HandleFunc("/appointments/{id}", doctor.CancelAppointment).Methods("DELETE")
 
+	// reviews left by patients
+	router.HandleFunc("/reviews", doctor.GetReviews).Methods("GET")
+	router.HandleFunc("/reviews/{id}/reply", doctor.ReplyToReview).Methods("PUT")
+	router.HandleFunc("/reviews/{id}/report", doctor.ReportReview).Methods("POST")
+
 	// patients routes
 	router.HandleFunc("/patients", doctor.GetPatients).Methods("GET")
 	router.HandleFunc("/patients/{id}", doctor.GetPatientDetails).Methods("GET")
+	router.HandleFunc("/patients/{id}/dependents/{dependentId}", doctor.GetDependentDetails).Methods("GET")
 }
@@ -9,4 +9,7 @@ func InitUserRoutes(router *mux.Router) {
 	router.HandleFunc("", me.GetUser).Methods("GET")
 	router.HandleFunc("", me.UpdateUser).Methods("PUT")
 	router.HandleFunc("", me.DeleteUser).Methods("DELETE")
+
+	router.HandleFunc("/calendar-feed", me.GetCalendarFeed).Methods("GET")
+	router.HandleFunc("/calendar-feed/rotate", me.RotateCalendarFeed).Methods("POST")
 }
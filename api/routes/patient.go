@@ -1,7 +1,10 @@
 package routes
 
 import (
+	"net/http"
+
 	"github.com/YahiaJouini/careflow/api/handlers/patient"
+	"github.com/YahiaJouini/careflow/api/middleware"
 	"github.com/gorilla/mux"
 )
 
@@ -10,12 +13,35 @@ func InitPatientRoutes(router *mux.Router) {
 	router.HandleFunc("/me", patient.GetPatient).Methods("GET")
 	router.HandleFunc("/me", patient.UpdatePatient).Methods("PUT")
 
+	router.HandleFunc("/dependents", patient.GetDependents).Methods("GET")
+	router.HandleFunc("/dependents", patient.CreateDependent).Methods("POST")
+	router.HandleFunc("/dependents/{id}", patient.UpdateDependent).Methods("PUT")
+	router.HandleFunc("/dependents/{id}", patient.DeleteDependent).Methods("DELETE")
+
 	router.HandleFunc("/appointments", patient.GetAppointments).Methods("GET")
-	router.HandleFunc("/appointments", patient.CreateAppointment).Methods("POST")
+	// the mobile app retries these on flaky networks, see the Idempotency-Key header
+	router.Handle("/appointments", middleware.Idempotency()(http.HandlerFunc(patient.CreateAppointment))).Methods("POST")
+	router.Handle("/appointments/series", middleware.Idempotency()(http.HandlerFunc(patient.CreateAppointmentSeries))).Methods("POST")
 	router.HandleFunc("/appointments/history", patient.GetMedicalHistory).Methods("GET")
+	router.HandleFunc("/appointments/{id}/history", patient.GetAppointmentHistory).Methods("GET")
+	router.HandleFunc("/appointments/{id}/ics", patient.DownloadAppointmentCalendar).Methods("GET")
+	router.HandleFunc("/appointments/{id}/check-in", patient.CheckInAppointment).Methods("POST")
+	router.HandleFunc("/appointments/{id}/review", patient.CreateReview).Methods("POST")
+	router.HandleFunc("/appointments/{id}/review", patient.UpdateReview).Methods("PUT")
+	router.HandleFunc("/appointments/{id}/proposals", patient.GetRescheduleProposals).Methods("GET")
+	router.HandleFunc("/appointments/{id}/proposals/accept", patient.AcceptRescheduleProposal).Methods("POST")
+	router.HandleFunc("/appointments/{id}/proposals/decline", patient.DeclineRescheduleProposal).Methods("POST")
 	router.HandleFunc("/appointments/{id}", patient.UpdateAppointment).Methods("PATCH")
 	router.HandleFunc("/appointments/{id}", patient.CancelAppointment).Methods("PUT")
 	router.HandleFunc("/appointments/{id}", patient.DeleteAppointment).Methods("DELETE")
 
+	router.HandleFunc("/reviews", patient.GetReviews).Methods("GET")
+
+	router.HandleFunc("/waitlist", patient.GetWaitlist).Methods("GET")
+	router.HandleFunc("/waitlist", patient.JoinWaitlist).Methods("POST")
+	router.HandleFunc("/waitlist/{id}", patient.LeaveWaitlist).Methods("DELETE")
+	router.HandleFunc("/waitlist/{id}/accept", patient.AcceptWaitlistOffer).Methods("POST")
+	router.HandleFunc("/waitlist/{id}/decline", patient.DeclineWaitlistOffer).Methods("POST")
+
 	router.HandleFunc("/health-assistance", patient.HealthAssistance).Methods("POST")
 }
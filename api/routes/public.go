@@ -8,4 +8,12 @@ import (
 func InitPublicRoutes(router *mux.Router) {
 	router.HandleFunc("/specialties", public.GetSpecialties).Methods("GET")
 	router.HandleFunc("/doctors", public.GetDoctors).Methods("GET")
+	router.HandleFunc("/doctors/search", public.SearchDoctors).Methods("GET")
+	router.HandleFunc("/doctors/{id:[0-9]+}", public.GetDoctor).Methods("GET")
+	router.HandleFunc("/doctors/{id}/slots", public.GetDoctorSlots).Methods("GET")
+	router.HandleFunc("/doctors/{id}/reviews", public.GetDoctorReviews).Methods("GET")
+	router.HandleFunc("/doctors/{id}/appointment-types", public.GetDoctorAppointmentTypes).Methods("GET")
+	router.HandleFunc("/locations", public.GetLocations).Methods("GET")
+	router.HandleFunc("/insurance-providers", public.GetInsuranceProviders).Methods("GET")
+	router.HandleFunc("/calendar/{token}.ics", public.GetCalendarFeed).Methods("GET")
 }
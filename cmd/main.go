@@ -4,10 +4,13 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	// embedded zone database, the alpine image has none
+	_ "time/tzdata"
 
 	"github.com/YahiaJouini/careflow/api/routes"
 	"github.com/YahiaJouini/careflow/internal/config"
 	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/jobs"
 	"github.com/rs/cors"
 )
 
@@ -25,6 +28,7 @@ func main() {
 	instance := db.InitializeDB()
 	defer instance.Close()
 	db.Migrate()
+	jobs.Start()
 
 	router := routes.InitializeRoutes()
 	fmt.Println("Server running on port", port)
@@ -32,7 +36,8 @@ func main() {
 	corsHandler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:3000", "http://localhost:4173"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "PUT", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type", "Authorization"},
+		AllowedHeaders:   []string{"Content-Type", "Authorization", "Idempotency-Key"},
+		ExposedHeaders:   []string{"Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           86400,
 	})
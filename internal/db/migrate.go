@@ -1,28 +1,262 @@
 package db
 
 import (
+	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"gorm.io/gorm"
 )
 
+const defaultAppointmentMinutes = 30
+
 func Migrate() {
+	addTimeZoneColumns()
+	hashCalendarFeedTokens()
+	backfillAppointmentDurations()
+
 	err := Db.AutoMigrate(
 		&models.User{},
 		&models.Specialty{},
+		&models.Location{},
+		&models.InsuranceProvider{},
 		&models.Doctor{},
+		&models.AppointmentSeries{},
+		&models.AppointmentType{},
+		&models.Dependent{},
 		&models.Appointment{},
 		&models.Patient{},
+		&models.DoctorSchedule{},
+		&models.AppointmentStatusHistory{},
+		&models.BookingPolicy{},
+		&models.WaitlistEntry{},
+		&models.DoctorTimeOff{},
+		&models.RescheduleProposal{},
+		&models.CalendarSyncConfig{},
+		&models.ExternalBusyBlock{},
+		&models.CalendarPushedEvent{},
+		&models.AppointmentReminder{},
+		&models.IdempotencyRecord{},
+		&models.Review{},
 	)
 	if err != nil {
 		log.Fatal("Migration failed:", err)
 	}
 
+	backfillWaitlistOffers()
+	encryptCalendarPasswords()
+	createAppointmentConstraints()
+	createSearchConfiguration()
 	seedSpecialties()
 	fmt.Println("migrations and seeding applied successfully")
 }
 
+// IANA name of the zone the server runs in, schedules were read in it before doctors had a zone
+func serverTimeZone() string {
+	name := strings.TrimPrefix(os.Getenv("TZ"), ":")
+	if name == "" {
+		// e.g. /usr/share/zoneinfo/Europe/Paris
+		if target, err := os.Readlink("/etc/localtime"); err == nil {
+			if i := strings.Index(target, "zoneinfo/"); i >= 0 {
+				name = target[i+len("zoneinfo/"):]
+			}
+		}
+	}
+	if _, err := time.LoadLocation(name); err != nil || name == "" || name == "Local" {
+		return "UTC"
+	}
+	return name
+}
+
+// users and doctors created before time zones existed keep the server's zone, new ones default to UTC
+func addTimeZoneColumns() {
+	zone := strings.ReplaceAll(serverTimeZone(), "'", "''")
+	for _, model := range []interface{}{&models.User{}, &models.Doctor{}} {
+		if !Db.Migrator().HasTable(model) || Db.Migrator().HasColumn(model, "time_zone") {
+			continue
+		}
+
+		stmt := &gorm.Statement{DB: Db}
+		if err := stmt.Parse(model); err != nil {
+			log.Fatal("Failed to add time zone column:", err)
+		}
+		err := Db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN time_zone varchar(64) NOT NULL DEFAULT '%s'", stmt.Schema.Table, zone)).Error
+		if err != nil {
+			log.Fatal("Failed to add time zone column:", err)
+		}
+	}
+}
+
+// feed tokens used to be stored as is, they are replaced by their sha256 so the existing feed urls keep working
+func hashCalendarFeedTokens() {
+	if !Db.Migrator().HasColumn(&models.User{}, "calendar_feed_token") {
+		return
+	}
+
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		statements := []string{
+			"UPDATE users SET calendar_feed_token = encode(sha256(convert_to(calendar_feed_token, 'UTF8')), 'hex') WHERE calendar_feed_token IS NOT NULL",
+			"DROP INDEX IF EXISTS idx_users_calendar_feed_token",
+			"ALTER TABLE users RENAME COLUMN calendar_feed_token TO calendar_feed_token_hash",
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal("Failed to hash calendar feed tokens:", err)
+	}
+}
+
+// appointments booked before they had a duration get the default length and the doctor's fee,
+// done before AutoMigrate makes ends_at required
+func backfillAppointmentDurations() {
+	if !Db.Migrator().HasTable(&models.Appointment{}) {
+		return
+	}
+
+	columns := []string{
+		"ALTER TABLE appointments ADD COLUMN IF NOT EXISTS duration_minutes bigint NOT NULL DEFAULT 0",
+		"ALTER TABLE appointments ADD COLUMN IF NOT EXISTS fee decimal(10,2)",
+		"ALTER TABLE appointments ADD COLUMN IF NOT EXISTS ends_at timestamptz",
+	}
+	for _, column := range columns {
+		if err := Db.Exec(column).Error; err != nil {
+			log.Fatal("Failed to add appointment duration columns:", err)
+		}
+	}
+
+	err := Db.Exec(`
+		UPDATE appointments SET
+			duration_minutes = ?,
+			ends_at = appointment_date + make_interval(mins => ?),
+			fee = COALESCE(fee, (SELECT consultation_fee FROM doctors WHERE doctors.id = appointments.doctor_id))
+		WHERE ends_at IS NULL`, defaultAppointmentMinutes, defaultAppointmentMinutes).Error
+	if err != nil {
+		log.Fatal("Failed to backfill appointment durations:", err)
+	}
+}
+
+// open waitlist offers hold the same default length
+func backfillWaitlistOffers() {
+	err := Db.Exec(`
+		UPDATE waitlist_entries SET offered_slot_end = offered_slot + make_interval(mins => ?)
+		WHERE offered_slot IS NOT NULL AND offered_slot_end IS NULL`, defaultAppointmentMinutes).Error
+	if err != nil {
+		log.Fatal("Failed to backfill waitlist offers:", err)
+	}
+}
+
+// calendar passwords used to be stored as is
+func encryptCalendarPasswords() {
+	var configs []models.CalendarSyncConfig
+	if err := Db.Where("password <> '' AND password NOT LIKE 'v1:%'").Find(&configs).Error; err != nil {
+		log.Fatal("Failed to load calendar sync configs:", err)
+	}
+
+	for _, config := range configs {
+		encrypted, err := auth.EncryptSecret(config.Password)
+		if err != nil {
+			log.Fatal("Failed to encrypt calendar password:", err)
+		}
+		if err := Db.Model(&config).Update("password", encrypted).Error; err != nil {
+			log.Fatal("Failed to encrypt calendar password:", err)
+		}
+	}
+}
+
+// rebuilt when the list of active statuses changes, the definition it was built from is kept
+// in the constraint's comment. The server doesn't start without it
+func createAppointmentConstraints() {
+	statuses := make([]string, len(models.ActiveStatuses))
+	for i, status := range models.ActiveStatuses {
+		statuses[i] = "'" + status + "'"
+	}
+
+	// last line of defense against double-booking, queries also check under a row lock
+	definition := fmt.Sprintf(
+		"EXCLUDE USING gist (doctor_id WITH =, tstzrange(appointment_date, ends_at) WITH &&) WHERE (deleted_at IS NULL AND status IN (%s))",
+		strings.Join(statuses, ", "),
+	)
+
+	err := Db.Transaction(func(tx *gorm.DB) error {
+		// replaced by the exclusion constraint
+		if err := tx.Exec("DROP INDEX IF EXISTS idx_appointments_active_slot").Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("CREATE EXTENSION IF NOT EXISTS btree_gist").Error; err != nil {
+			return err
+		}
+
+		var current sql.NullString
+		err := tx.Raw(
+			"SELECT obj_description(oid, 'pg_constraint') FROM pg_constraint WHERE conname = ? AND conrelid = 'appointments'::regclass",
+			models.NoOverlapConstraint,
+		).Row().Scan(&current)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return err
+		}
+		if current.Valid && current.String == definition {
+			return nil
+		}
+
+		// existing overlaps make the ADD fail, they must be cleaned up by hand
+		statements := []string{
+			"ALTER TABLE appointments DROP CONSTRAINT IF EXISTS " + models.NoOverlapConstraint,
+			fmt.Sprintf("ALTER TABLE appointments ADD CONSTRAINT %s %s", models.NoOverlapConstraint, definition),
+			fmt.Sprintf("COMMENT ON CONSTRAINT %s ON appointments IS '%s'", models.NoOverlapConstraint, strings.ReplaceAll(definition, "'", "''")),
+		}
+		for _, statement := range statements {
+			if err := tx.Exec(statement).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal("Failed to create appointment overlap constraint:", err)
+	}
+}
+
+// text search configuration used by the doctor search: no stemming since it mostly matches names,
+// accents are ignored so "Hélène" is found with "helene"
+func createSearchConfiguration() {
+	if err := Db.Exec("CREATE EXTENSION IF NOT EXISTS unaccent").Error; err != nil {
+		log.Fatal("Failed to enable unaccent:", err)
+	}
+
+	err := Db.Exec(`
+		DO $$
+		BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = '` + models.SearchConfiguration + `') THEN
+				CREATE TEXT SEARCH CONFIGURATION ` + models.SearchConfiguration + ` (COPY = simple);
+				ALTER TEXT SEARCH CONFIGURATION ` + models.SearchConfiguration + `
+					ALTER MAPPING FOR asciiword, asciihword, hword_asciipart, word, hword, hword_part WITH unaccent, simple;
+			END IF;
+		END $$`).Error
+	if err != nil {
+		log.Fatal("Failed to create search configuration:", err)
+	}
+
+	// unaccent leaves arabic vowel marks and tatweel alone, they are dropped before indexing
+	err = Db.Exec(`
+		CREATE OR REPLACE FUNCTION ` + models.SearchFoldFunction + `(value text) RETURNS text
+		LANGUAGE sql IMMUTABLE STRICT PARALLEL SAFE
+		AS $$ SELECT regexp_replace(value, '[\u064B-\u0652\u0640]', '', 'g') $$`).Error
+	if err != nil {
+		log.Fatal("Failed to create search fold function:", err)
+	}
+}
+
 func seedSpecialties() {
 	var count int64
 	Db.Model(&models.Specialty{}).Count(&count)
@@ -11,8 +11,94 @@ const (
 	StatusConfirmed = "confirmed"
 	StatusCancelled = "cancelled"
 	StatusCompleted = "completed"
+	StatusNoShow    = "no_show"
+	// the doctor became unavailable, the patient has to pick another time
+	StatusNeedsReschedule = "needs_reschedule"
+	// the doctor offered new times, the original slot is kept until the patient answers
+	StatusRescheduleProposed = "reschedule_proposed"
+	// the patient arrived and waits to be seen, then is with the doctor
+	StatusCheckedIn  = "checked_in"
+	StatusInProgress = "in_progress"
 )
 
+// who is allowed to move an appointment from one status to another,
+// anything not listed here is rejected
+var StatusTransitions = map[string]map[string][]string{
+	StatusPending: {
+		StatusConfirmed:          {ActorDoctor},
+		StatusCancelled:          {ActorPatient, ActorDoctor, ActorSystem},
+		StatusNeedsReschedule:    {ActorDoctor, ActorSystem},
+		StatusRescheduleProposed: {ActorDoctor},
+	},
+	StatusConfirmed: {
+		// patient moved the date, the doctor has to confirm again
+		StatusPending:            {ActorPatient},
+		StatusCompleted:          {ActorDoctor},
+		StatusCancelled:          {ActorPatient, ActorDoctor, ActorSystem},
+		StatusNoShow:             {ActorDoctor},
+		StatusNeedsReschedule:    {ActorDoctor, ActorSystem},
+		StatusRescheduleProposed: {ActorDoctor},
+		// only on the day of the appointment
+		StatusCheckedIn: {ActorPatient, ActorDoctor},
+	},
+	StatusCheckedIn: {
+		StatusInProgress: {ActorDoctor},
+		// checked in by mistake
+		StatusConfirmed:       {ActorDoctor},
+		StatusCancelled:       {ActorDoctor},
+		StatusNeedsReschedule: {ActorDoctor, ActorSystem},
+	},
+	StatusInProgress: {
+		StatusCompleted: {ActorDoctor},
+	},
+	StatusNeedsReschedule: {
+		// a new time picked by the patient still needs the doctor's confirmation
+		StatusPending:            {ActorPatient},
+		StatusConfirmed:          {ActorDoctor},
+		StatusCancelled:          {ActorPatient, ActorDoctor, ActorSystem},
+		StatusRescheduleProposed: {ActorDoctor},
+	},
+	StatusRescheduleProposed: {
+		// the patient accepted one of the proposed times, the system only
+		// moves it back to its previous status when the proposal expires
+		StatusConfirmed:       {ActorPatient, ActorSystem},
+		StatusPending:         {ActorSystem},
+		StatusNeedsReschedule: {ActorDoctor, ActorSystem},
+		StatusCancelled:       {ActorPatient, ActorDoctor, ActorSystem},
+	},
+}
+
+func CanTransition(from, to, actorRole string) bool {
+	for _, role := range StatusTransitions[from][to] {
+		if role == actorRole {
+			return true
+		}
+	}
+	return false
+}
+
+// why an appointment was cancelled, picked by the patient or the doctor
+const (
+	CancelReasonIllness           = "illness"
+	CancelReasonScheduleConflict  = "schedule_conflict"
+	CancelReasonFeelingBetter     = "feeling_better"
+	CancelReasonDoctorUnavailable = "doctor_unavailable"
+	CancelReasonEmergency         = "emergency"
+	CancelReasonOther             = "other"
+)
+
+// reason codes set by CareFlow itself, they never count as late cancellations
+const (
+	CancelReasonDeclinedReschedule = "declined_reschedule"
+	CancelReasonExpired            = "expired"
+)
+
+// statuses that keep a doctor's time slot reserved
+var ActiveStatuses = []string{StatusPending, StatusConfirmed, StatusRescheduleProposed, StatusCheckedIn, StatusInProgress}
+
+// exclusion constraint preventing overlapping active appointments of a doctor
+const NoOverlapConstraint = "appointments_no_overlap"
+
 type Appointment struct {
 	ID uint `gorm:"primaryKey" json:"id"`
 
@@ -22,13 +108,50 @@ type Appointment struct {
 	DoctorID uint   `gorm:"not null" json:"doctorId"`
 	Doctor   Doctor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"doctor,omitempty"`
 
+	// set when the patient booked for one of their dependents, who is then the one seen by the doctor
+	DependentID *uint      `gorm:"index" json:"dependentId,omitempty"`
+	Dependent   *Dependent `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"dependent,omitempty"`
+
 	AppointmentDate time.Time `gorm:"not null" json:"appointmentDate"`
+	EndsAt          time.Time `gorm:"not null" json:"endsAt"`
 	Reason          string    `gorm:"type:text" json:"reason"`
-	Status          string    `gorm:"type:varchar(20);default:'pending';check(status IN ('pending', 'confirmed', 'cancelled', 'completed'))" json:"status"`
+	Status          string    `gorm:"type:varchar(20);default:'pending';check:status IN ('pending', 'confirmed', 'cancelled', 'completed', 'no_show', 'needs_reschedule', 'reschedule_proposed', 'checked_in', 'in_progress')" json:"status"`
+
+	// taken from the schedule block of the booked slot
+	LocationID *uint     `json:"locationId,omitempty"`
+	Location   *Location `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"location,omitempty"`
+
+	AppointmentTypeID *uint            `json:"appointmentTypeId,omitempty"`
+	AppointmentType   *AppointmentType `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"appointmentType,omitempty"`
+
+	// copied from the appointment type (or the doctor) when booking
+	DurationMinutes int     `gorm:"not null; default:0" json:"durationMinutes"`
+	Fee             float64 `gorm:"type:decimal(10,2)" json:"fee"`
+
+	SeriesID *uint              `gorm:"index" json:"seriesId,omitempty"`
+	Series   *AppointmentSeries `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"-"`
+
+	// filled when the appointment is cancelled
+	CancellationReasonCode string     `gorm:"type:varchar(30)" json:"cancellationReasonCode,omitempty"`
+	CancellationNote       string     `gorm:"type:text" json:"cancellationNote,omitempty"`
+	CancelledByID          *uint      `json:"cancelledById,omitempty"`
+	CancelledByRole        string     `gorm:"type:varchar(20)" json:"cancelledByRole,omitempty"`
+	CancelledAt            *time.Time `json:"cancelledAt,omitempty"`
+	// cancelled with less notice than the booking policy asks for
+	LateCancellation bool `gorm:"not null; default:false" json:"lateCancellation"`
 
 	DoctorNotes string   `gorm:"type:text" json:"doctorNotes"`
 	Medications []string `gorm:"type:jsonb;serializer:json" json:"medications"`
 
+	// waiting room times, for the doctor's queue
+	CheckedInAt *time.Time `json:"checkedInAt,omitempty"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+
+	// confirmed, checked in or started but already over, waiting for the doctor to complete it or mark a no-show
+	AwaitingClosure bool `gorm:"-" json:"awaitingClosure,omitempty"`
+	// things the patient should know about the booking, e.g. an insurance the doctor doesn't accept
+	Warnings []string `gorm:"-" json:"warnings,omitempty"`
+
 	CreatedAt time.Time      `json:"createdAt"`
 	UpdatedAt time.Time      `json:"-"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// who triggered an appointment status change
+const (
+	ActorPatient = "patient"
+	ActorDoctor  = "doctor"
+	ActorAdmin   = "admin"
+	ActorSystem  = "system"
+)
+
+type AppointmentStatusHistory struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	AppointmentID uint        `gorm:"not null;index" json:"appointmentId"`
+	Appointment   Appointment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	// empty when the appointment was just created
+	FromStatus string `gorm:"type:varchar(20)" json:"fromStatus"`
+	ToStatus   string `gorm:"type:varchar(20); not null" json:"toStatus"`
+
+	// nil for changes made by the system
+	ActorID   *uint  `json:"actorId"`
+	ActorRole string `gorm:"type:varchar(20); not null" json:"actorRole"`
+	Reason    string `gorm:"type:text" json:"reason"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+func (AppointmentStatusHistory) TableName() string {
+	return "appointment_status_history"
+}
@@ -0,0 +1,68 @@
+package models
+
+import "testing"
+
+func TestCanTransition(t *testing.T) {
+	tests := []struct {
+		name  string
+		from  string
+		to    string
+		actor string
+		want  bool
+	}{
+		{"doctor confirms a request", StatusPending, StatusConfirmed, ActorDoctor, true},
+		{"patient can't confirm their own request", StatusPending, StatusConfirmed, ActorPatient, false},
+		{"system expires a request", StatusPending, StatusCancelled, ActorSystem, true},
+		{"patient moving a confirmed date asks again", StatusConfirmed, StatusPending, ActorPatient, true},
+		{"patient checks in", StatusConfirmed, StatusCheckedIn, ActorPatient, true},
+		{"system can't check in", StatusConfirmed, StatusCheckedIn, ActorSystem, false},
+		{"doctor starts the visit", StatusCheckedIn, StatusInProgress, ActorDoctor, true},
+		{"patient can't start the visit", StatusCheckedIn, StatusInProgress, ActorPatient, false},
+		{"doctor completes a started visit", StatusInProgress, StatusCompleted, ActorDoctor, true},
+		{"a started visit can't be cancelled", StatusInProgress, StatusCancelled, ActorDoctor, false},
+		{"pending can't be completed", StatusPending, StatusCompleted, ActorDoctor, false},
+		{"patient accepts a proposal", StatusRescheduleProposed, StatusConfirmed, ActorPatient, true},
+		{"expired proposal falls back to pending", StatusRescheduleProposed, StatusPending, ActorSystem, true},
+		{"completed is final", StatusCompleted, StatusCancelled, ActorDoctor, false},
+		{"cancelled is final", StatusCancelled, StatusPending, ActorPatient, false},
+		{"no-show is final", StatusNoShow, StatusConfirmed, ActorDoctor, false},
+		{"unknown status", "unknown", StatusConfirmed, ActorDoctor, false},
+		{"same status is not a transition", StatusConfirmed, StatusConfirmed, ActorDoctor, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CanTransition(tt.from, tt.to, tt.actor); got != tt.want {
+				t.Errorf("CanTransition(%q, %q, %q) = %v, want %v", tt.from, tt.to, tt.actor, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStatusTransitionsTargetKnownStatuses(t *testing.T) {
+	known := map[string]bool{
+		StatusPending: true, StatusConfirmed: true, StatusCancelled: true, StatusCompleted: true,
+		StatusNoShow: true, StatusNeedsReschedule: true, StatusRescheduleProposed: true,
+		StatusCheckedIn: true, StatusInProgress: true,
+	}
+	actors := map[string]bool{ActorPatient: true, ActorDoctor: true, ActorSystem: true}
+
+	for from, targets := range StatusTransitions {
+		if !known[from] {
+			t.Errorf("unknown source status %q", from)
+		}
+		for to, roles := range targets {
+			if !known[to] {
+				t.Errorf("%s: unknown target status %q", from, to)
+			}
+			if len(roles) == 0 {
+				t.Errorf("%s -> %s: nobody is allowed", from, to)
+			}
+			for _, role := range roles {
+				if !actors[role] {
+					t.Errorf("%s -> %s: unknown actor %q", from, to, role)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	ModeInPerson = "in_person"
+	ModeVideo    = "video"
+)
+
+// kind of visit a doctor offers (first consultation, follow-up...) with its own length and price
+type AppointmentType struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	DoctorID uint   `gorm:"not null;index" json:"doctorId"`
+	Doctor   Doctor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	Name            string  `gorm:"type:varchar(100); not null" json:"name"`
+	DurationMinutes int     `gorm:"not null" json:"durationMinutes"`
+	Fee             float64 `gorm:"type:decimal(10,2); default:0.00" json:"fee"`
+	Mode            string  `gorm:"type:varchar(20); not null; default:'in_person'; check:mode IN ('in_person', 'video')" json:"mode"`
+	IsActive        bool    `gorm:"default:true" json:"isActive"`
+
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
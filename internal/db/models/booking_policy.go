@@ -0,0 +1,30 @@
+package models
+
+import "time"
+
+// platform wide booking rules managed by admins, stored as a single row
+type BookingPolicy struct {
+	ID uint `gorm:"primaryKey" json:"-"`
+
+	// patients with at least this many no-shows can't book anymore, 0 disables the rule
+	MaxNoShows int `gorm:"not null; default:0" json:"maxNoShows"`
+	// only no-shows of the last N days are counted, 0 counts all of them
+	NoShowWindowDays int `gorm:"not null; default:0" json:"noShowWindowDays"`
+
+	// how long a waitlisted patient has to accept a freed slot
+	WaitlistOfferMinutes int `gorm:"not null; default:120" json:"waitlistOfferMinutes"`
+
+	// cancelling with less notice than this flags the cancellation as late, 0 disables the rule
+	MinCancelNoticeHours int `gorm:"not null; default:24" json:"minCancelNoticeHours"`
+	// patients can't cancel at all inside the notice window, doctors still can
+	BlockLateCancellations bool `gorm:"not null; default:false" json:"blockLateCancellations"`
+
+	// how long a patient has to answer a reschedule proposal from the doctor
+	RescheduleProposalHours int `gorm:"not null; default:48" json:"rescheduleProposalHours"`
+
+	// pending requests older than this are cancelled if the doctor did not answer, 0 only
+	// cancels them once their time has passed
+	PendingExpiryHours int `gorm:"not null; default:0" json:"pendingExpiryHours"`
+
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// CalDAV calendar of a doctor that CareFlow writes appointments to and reads busy times from
+type CalendarSyncConfig struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	DoctorID uint   `gorm:"not null;uniqueIndex" json:"doctorId"`
+	Doctor   Doctor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	// url of the calendar collection
+	URL      string `gorm:"type:varchar(500); not null" json:"url"`
+	Username string `gorm:"type:varchar(255)" json:"username"`
+	// encrypted with the server key
+	Password string `gorm:"type:text" json:"-"`
+	Enabled  bool   `gorm:"not null; default:true" json:"enabled"`
+
+	LastSyncedAt *time.Time `json:"lastSyncedAt,omitempty"`
+	// appointments changed after this were not pushed yet
+	LastPushedAt *time.Time `json:"-"`
+	LastError    string     `gorm:"type:text" json:"lastError,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"-"`
+}
+
+// appointment written to the doctor's external calendar, so its event can be removed
+// once the appointment is no longer theirs
+type CalendarPushedEvent struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	DoctorID      uint `gorm:"not null;uniqueIndex:idx_calendar_pushed_event" json:"doctorId"`
+	AppointmentID uint `gorm:"not null;uniqueIndex:idx_calendar_pushed_event" json:"appointmentId"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// busy time pulled from the doctor's external calendar, replaced on every sync
+type ExternalBusyBlock struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	DoctorID uint   `gorm:"not null;index" json:"doctorId"`
+	Doctor   Doctor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	UID      string    `gorm:"type:varchar(255)" json:"uid"`
+	StartsAt time.Time `gorm:"not null" json:"startsAt"`
+	EndsAt   time.Time `gorm:"not null" json:"endsAt"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	RelationshipChild  = "child"
+	RelationshipParent = "parent"
+	RelationshipSpouse = "spouse"
+	RelationshipOther  = "other"
+)
+
+// person without an account (a child, an elderly parent...) whose appointments
+// are booked and managed by the patient account holding them
+type Dependent struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	GuardianID uint `gorm:"not null;index" json:"guardianId"`
+	Guardian   User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	FirstName    string    `gorm:"type:varchar(100); not null" json:"firstName"`
+	LastName     string    `gorm:"type:varchar(100); not null" json:"lastName"`
+	DateOfBirth  time.Time `gorm:"type:date; not null" json:"dateOfBirth"`
+	Relationship string    `gorm:"type:varchar(20); not null; check:relationship IN ('child', 'parent', 'spouse', 'other')" json:"relationship"`
+
+	// same medical data as a patient
+	Height    float64 `gorm:"type:decimal(5,2)" json:"height"`
+	Weight    float64 `gorm:"type:decimal(5,2)" json:"weight"`
+	BloodType string  `gorm:"type:varchar(3)" json:"bloodType"`
+
+	ChronicConditions []string `gorm:"type:jsonb;serializer:json" json:"chronicConditions"`
+	Allergies         []string `gorm:"type:jsonb;serializer:json" json:"allergies"`
+	Medications       []string `gorm:"type:jsonb;serializer:json" json:"medications"`
+
+	CreatedAt time.Time      `json:"createdAt"`
+	UpdatedAt time.Time      `json:"-"`
+	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+}
@@ -5,6 +5,19 @@ import (
 	"gorm.io/gorm"
 )
 
+// text search configuration and normalization function of the doctor search, both created by the migration
+const (
+	SearchConfiguration = "careflow_search"
+	SearchFoldFunction  = "careflow_search_fold"
+)
+
+// diploma listed on a doctor's profile
+type Degree struct {
+	Title       string `json:"title"`
+	Institution string `json:"institution"`
+	Year        int    `json:"year,omitempty"`
+}
+
 type Doctor struct {
 	ID uint `gorm:"primaryKey" json:"id"`
 
@@ -18,9 +31,27 @@ type Doctor struct {
 	LicenseNumber   string  `gorm:"type:varchar(50); not null; unique" json:"licenseNumber"`
 	ConsultationFee float64 `gorm:"type:decimal(10,2); default:0.00" json:"consultationFee"`
 
+	// ISO 639-1 codes of the languages the doctor consults in, e.g. ar, fr, en
+	Languages            []string `gorm:"type:jsonb;serializer:json" json:"languages"`
+	Education            []Degree `gorm:"type:jsonb;serializer:json" json:"education"`
+	YearsOfExperience    int      `gorm:"not null; default:0" json:"yearsOfExperience"`
+	HospitalAffiliations []string `gorm:"type:jsonb;serializer:json" json:"hospitalAffiliations"`
+
 	IsAvailable bool `gorm:"default:true" json:"isAvailable"`
 	IsVerified  bool `gorm:"default:false" json:"isVerified"`
 
+	// IANA zone of the practice, the weekly schedule is wall clock time in it
+	TimeZone string `gorm:"type:varchar(64); not null; default:'UTC'" json:"timeZone"`
+
+	// clinics the doctor works at, each schedule block says which one
+	Locations []Location `gorm:"many2many:doctor_locations;" json:"locations,omitempty"`
+	// insurers whose patients are covered for a visit
+	AcceptedInsurances []InsuranceProvider `gorm:"many2many:doctor_insurance_providers;" json:"acceptedInsurances,omitempty"`
+
+	// published reviews, kept up to date whenever a review changes
+	AverageRating float64 `gorm:"type:decimal(3,2); not null; default:0" json:"averageRating"`
+	ReviewCount   int     `gorm:"not null; default:0" json:"reviewCount"`
+
 	CreatedAt time.Time      `json:"createdAt"`
 	UpdatedAt time.Time      `json:"-"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// first response to a request sent with an Idempotency-Key header, replayed when the
+// client retries with the same key. Keys are scoped per user, 0 for anonymous requests
+type IdempotencyRecord struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	UserID uint   `gorm:"not null;uniqueIndex:idx_idempotency_key" json:"userId"`
+	Key    string `gorm:"type:varchar(255); not null;uniqueIndex:idx_idempotency_key" json:"key"`
+	// hash of the method, path and body, a key can't be reused for another request
+	RequestHash string `gorm:"type:varchar(64); not null" json:"-"`
+
+	// false while the first request is still running
+	Completed   bool   `gorm:"not null; default:false" json:"completed"`
+	StatusCode  int    `json:"statusCode"`
+	ContentType string `gorm:"type:varchar(255)" json:"-"`
+	Body        []byte `json:"-"`
+
+	// an unfinished record past this time belongs to a request that never came back,
+	// the key can be claimed again
+	LockedUntil time.Time `gorm:"not null; default:now()" json:"-"`
+
+	ExpiresAt time.Time `gorm:"not null;index" json:"expiresAt"`
+	CreatedAt time.Time `json:"createdAt"`
+}
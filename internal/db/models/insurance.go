@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+const (
+	InsurancePublic  = "public"
+	InsurancePrivate = "private"
+)
+
+// insurer of the catalog managed by admins, CNAM or a private insurance company
+type InsuranceProvider struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	Name    string `gorm:"type:varchar(150); not null; unique" json:"name"`
+	Kind    string `gorm:"type:varchar(20); not null; default:'private'; check:kind IN ('public', 'private')" json:"kind"`
+	Website string `gorm:"type:varchar(255)" json:"website,omitempty"`
+
+	// inactive providers can no longer be picked but stay on existing policies
+	IsActive bool `gorm:"not null; default:true" json:"isActive"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"-"`
+}
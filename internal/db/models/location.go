@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// clinic or practice where doctors see patients, shared by every doctor working there
+type Location struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	Name       string `gorm:"type:varchar(150); not null" json:"name"`
+	Address    string `gorm:"type:varchar(255); not null" json:"address"`
+	City       string `gorm:"type:varchar(100); not null; index" json:"city"`
+	PostalCode string `gorm:"type:varchar(20)" json:"postalCode"`
+	Country    string `gorm:"type:varchar(100); not null" json:"country"`
+	Phone      string `gorm:"type:varchar(30)" json:"phone,omitempty"`
+
+	Latitude  float64 `gorm:"not null" json:"latitude"`
+	Longitude float64 `gorm:"not null" json:"longitude"`
+
+	// doctor who added the location, the only one besides admins who can edit it.
+	// Nil for locations nobody owns anymore
+	CreatedByID *uint `gorm:"index" json:"-"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"-"`
+}
@@ -1,5 +1,7 @@
 package models
 
+import "time"
+
 type Patient struct {
 	ID uint `gorm:"primaryKey" json:"id"`
 
@@ -13,4 +15,12 @@ type Patient struct {
 	ChronicConditions []string `gorm:"type:jsonb;serializer:json" json:"chronicConditions"`
 	Allergies         []string `gorm:"type:jsonb;serializer:json" json:"allergies"`
 	Medications       []string `gorm:"type:jsonb;serializer:json" json:"medications"`
+
+	// insurance policy, no provider when the patient pays for their visits
+	InsuranceProviderID *uint              `json:"insuranceProviderId,omitempty"`
+	InsuranceProvider   *InsuranceProvider `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"insuranceProvider,omitempty"`
+	PolicyNumber        string             `gorm:"type:varchar(50)" json:"policyNumber"`
+	// insured person when the patient is covered through someone else
+	PolicyHolder    string     `gorm:"type:varchar(150)" json:"policyHolder"`
+	PolicyExpiresAt *time.Time `gorm:"type:date" json:"policyExpiresAt,omitempty"`
 }
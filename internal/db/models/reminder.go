@@ -0,0 +1,22 @@
+package models
+
+import "time"
+
+// reminder email of an appointment. The row is claimed before sending and its unique index
+// makes sure each reminder goes out once, even with several instances running the jobs. A claim
+// that was never marked as sent can be taken again once its lease is over
+type AppointmentReminder struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	AppointmentID uint        `gorm:"not null;uniqueIndex:idx_appointment_reminder" json:"appointmentId"`
+	Appointment   Appointment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	// how long before the appointment it is sent
+	OffsetMinutes int `gorm:"not null;uniqueIndex:idx_appointment_reminder" json:"offsetMinutes"`
+	// time the reminder was for, a rescheduled appointment gets new reminders
+	AppointmentDate time.Time `gorm:"not null;uniqueIndex:idx_appointment_reminder" json:"appointmentDate"`
+
+	ClaimedAt time.Time  `gorm:"not null; default:now()" json:"claimedAt"`
+	SentAt    *time.Time `json:"sentAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
@@ -0,0 +1,36 @@
+package models
+
+import "time"
+
+const (
+	ProposalOpen      = "open"
+	ProposalAccepted  = "accepted"
+	ProposalDeclined  = "declined"
+	ProposalExpired   = "expired"
+	ProposalCancelled = "cancelled"
+)
+
+// new times offered by the doctor for an appointment, waiting for the patient's answer
+type RescheduleProposal struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	AppointmentID uint        `gorm:"not null;index" json:"appointmentId"`
+	Appointment   Appointment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	ProposedByID uint `gorm:"not null" json:"proposedById"`
+	ProposedBy   User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	Options []time.Time `gorm:"type:jsonb;serializer:json" json:"options"`
+	Note    string      `gorm:"type:text" json:"note,omitempty"`
+
+	Status string `gorm:"type:varchar(20); not null; default:'open'; check:status IN ('open', 'accepted', 'declined', 'expired', 'cancelled')" json:"status"`
+	// appointment status to go back to if the patient never answers
+	PreviousStatus string `gorm:"type:varchar(20); not null" json:"-"`
+
+	ChosenTime  *time.Time `json:"chosenTime,omitempty"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expiresAt"`
+	RespondedAt *time.Time `json:"respondedAt,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"-"`
+}
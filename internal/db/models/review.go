@@ -0,0 +1,44 @@
+package models
+
+import "time"
+
+const (
+	ReviewPublished = "published"
+	ReviewHidden    = "hidden"
+)
+
+// rating left by a patient after a completed appointment, one per appointment
+type Review struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	AppointmentID uint        `gorm:"not null;uniqueIndex" json:"appointmentId"`
+	Appointment   Appointment `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	PatientID uint `gorm:"not null;index" json:"patientId"`
+	Patient   User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"patient,omitempty"`
+
+	DoctorID uint   `gorm:"not null;index" json:"doctorId"`
+	Doctor   Doctor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"doctor,omitempty"`
+
+	Rating  int    `gorm:"not null; check:rating BETWEEN 1 AND 5" json:"rating"`
+	Comment string `gorm:"type:text" json:"comment"`
+
+	// public answer of the doctor
+	Reply     string     `gorm:"type:text" json:"reply,omitempty"`
+	RepliedAt *time.Time `json:"repliedAt,omitempty"`
+
+	// hidden reviews are only seen by their author, the doctor and admins
+	Status string `gorm:"type:varchar(20); not null; default:'published'; index; check:status IN ('published', 'hidden')" json:"status"`
+
+	// set by the doctor to bring the review to the moderation queue
+	ReportedAt   *time.Time `json:"reportedAt,omitempty"`
+	ReportReason string     `gorm:"type:text" json:"reportReason,omitempty"`
+
+	// last admin decision, a review edited by its author goes back to the queue
+	ModeratedAt      *time.Time `json:"moderatedAt,omitempty"`
+	ModeratedByID    *uint      `json:"moderatedById,omitempty"`
+	ModerationReason string     `gorm:"type:text" json:"moderationReason,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"time"
+)
+
+// one block of weekly recurring working hours (a doctor can have several per day)
+type DoctorSchedule struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	DoctorID uint   `gorm:"not null;index" json:"doctorId"`
+	Doctor   Doctor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	// same numbering as time.Weekday (0 = sunday)
+	DayOfWeek int `gorm:"not null; check:day_of_week BETWEEN 0 AND 6" json:"dayOfWeek"`
+
+	// wall clock times formatted as HH:MM
+	StartTime  string `gorm:"type:varchar(5); not null" json:"startTime"`
+	EndTime    string `gorm:"type:varchar(5); not null" json:"endTime"`
+	BreakStart string `gorm:"type:varchar(5)" json:"breakStart,omitempty"`
+	BreakEnd   string `gorm:"type:varchar(5)" json:"breakEnd,omitempty"`
+
+	// slot length in minutes
+	SlotDuration int `gorm:"not null; default:30" json:"slotDuration"`
+
+	// where the doctor works during this block, nil when the doctor has no locations
+	LocationID *uint     `json:"locationId,omitempty"`
+	Location   *Location `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"location,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"-"`
+}
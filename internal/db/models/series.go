@@ -0,0 +1,26 @@
+package models
+
+import "time"
+
+const (
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+)
+
+// recurring follow-ups booked in one request, each occurrence is a regular Appointment
+type AppointmentSeries struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	PatientID uint `gorm:"not null;index" json:"patientId"`
+	DoctorID  uint `gorm:"not null;index" json:"doctorId"`
+
+	Frequency string `gorm:"type:varchar(10); not null; check:frequency IN ('weekly', 'monthly')" json:"frequency"`
+	// every N weeks or months
+	Interval    int        `gorm:"not null; default:1" json:"interval"`
+	Occurrences int        `gorm:"not null" json:"occurrences"`
+	Until       *time.Time `json:"until,omitempty"`
+
+	Appointments []Appointment `gorm:"foreignKey:SeriesID" json:"appointments,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+const (
+	TimeOffVacation   = "vacation"
+	TimeOffConference = "conference"
+	TimeOffSickLeave  = "sick_leave"
+)
+
+// period in which the doctor takes no appointments
+type DoctorTimeOff struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	DoctorID uint   `gorm:"not null;index" json:"doctorId"`
+	Doctor   Doctor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	Kind     string    `gorm:"type:varchar(20); not null; check:kind IN ('vacation', 'conference', 'sick_leave')" json:"kind"`
+	StartsAt time.Time `gorm:"not null" json:"startsAt"`
+	EndsAt   time.Time `gorm:"not null" json:"endsAt"`
+	Note     string    `gorm:"type:text" json:"note,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"-"`
+}
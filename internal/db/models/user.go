@@ -16,6 +16,12 @@ type User struct {
 	Verified  bool   `gorm:"type:boolean; default:false"`
 	Role      string `gorm:"type:varchar(255); not null; default:'patient'; check(role IN ('admin', 'doctor','patient'))" json:"role"`
 
+	// sha256 of the secret part of the calendar feed url, nil until the user asks for the feed
+	CalendarFeedTokenHash *string `gorm:"type:varchar(64); uniqueIndex" json:"-"`
+
+	// IANA zone dates are shown in, e.g. Europe/Paris
+	TimeZone string `gorm:"type:varchar(64); not null; default:'UTC'" json:"timeZone"`
+
 	Doctor             *Doctor        `json:"doctor,omitempty" gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	Patient            *Patient       `json:"patient,omitempty" gorm:"foreignKey:UserID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	VerificationCode   string         `gorm:"type:varchar(6)" json:"-"`
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+const (
+	WaitlistWaiting   = "waiting"
+	WaitlistOffered   = "offered"
+	WaitlistAccepted  = "accepted"
+	WaitlistExpired   = "expired"
+	WaitlistCancelled = "cancelled"
+)
+
+// patient waiting for a slot with a doctor inside a preferred date range
+type WaitlistEntry struct {
+	ID uint `gorm:"primaryKey" json:"id"`
+
+	PatientID uint `gorm:"not null;index" json:"patientId"`
+	Patient   User `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+
+	DoctorID uint   `gorm:"not null;index" json:"doctorId"`
+	Doctor   Doctor `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"doctor,omitempty"`
+
+	PreferredFrom time.Time `gorm:"not null" json:"preferredFrom"`
+	PreferredTo   time.Time `gorm:"not null" json:"preferredTo"`
+	Reason        string    `gorm:"type:text" json:"reason"`
+
+	AppointmentTypeID *uint            `json:"appointmentTypeId,omitempty"`
+	AppointmentType   *AppointmentType `gorm:"constraint:OnUpdate:CASCADE,OnDelete:SET NULL;" json:"appointmentType,omitempty"`
+
+	Status string `gorm:"type:varchar(20); not null; default:'waiting'; check:status IN ('waiting', 'offered', 'accepted', 'expired', 'cancelled')" json:"status"`
+
+	// set while an offer is open, the slot is held for this patient until it expires
+	OfferedSlot    *time.Time `json:"offeredSlot,omitempty"`
+	OfferedSlotEnd *time.Time `json:"offeredSlotEnd,omitempty"`
+	OfferExpiresAt *time.Time `json:"offerExpiresAt,omitempty"`
+
+	// appointment created when the offer was accepted
+	AppointmentID *uint `json:"appointmentId,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"-"`
+}
@@ -0,0 +1,110 @@
+package queries
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/pkg/mails"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// cancels the pending requests the doctor never answered, once their time has passed or
+// once they are older than the booking policy allows, and tells the patients
+func ExpireStaleAppointments() error {
+	var expiredIDs []uint
+	var offers []models.WaitlistEntry
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		policy, err := getBookingPolicy(tx)
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ?", models.StatusPending)
+		if policy.PendingExpiryHours > 0 {
+			query = query.Where("(appointment_date <= ? OR created_at <= ?)", now, now.Add(-time.Duration(policy.PendingExpiryHours)*time.Hour))
+		} else {
+			query = query.Where("appointment_date <= ?", now)
+		}
+
+		var stale []models.Appointment
+		if err := query.Find(&stale).Error; err != nil {
+			return err
+		}
+		if len(stale) == 0 {
+			return nil
+		}
+
+		offers, _, err = cancelOccurrences(tx, stale, Actor{Role: models.ActorSystem}, CancelAppointmentRequest{
+			ReasonCode: models.CancelReasonExpired,
+			Reason:     "The doctor did not confirm the request in time",
+		})
+		if err != nil {
+			return err
+		}
+
+		for _, appt := range stale {
+			expiredIDs = append(expiredIDs, appt.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	notifyWaitlistOffers(offers)
+	notifyExpiredRequests(expiredIDs)
+	return nil
+}
+
+// emails the patients whose request expired, only call it once the transaction is committed
+func notifyExpiredRequests(appointmentIDs []uint) {
+	if len(appointmentIDs) == 0 {
+		return
+	}
+
+	go func() {
+		var appointments []models.Appointment
+		if err := db.Db.Preload("Patient").Preload("Doctor.User").Find(&appointments, appointmentIDs).Error; err != nil {
+			fmt.Println("failed to load expired appointments", err)
+			return
+		}
+
+		for _, appt := range appointments {
+			mails.SendNotification(appt.Patient.Email, mails.Notification{
+				Subject: "Your appointment request with Dr. " + appt.Doctor.User.LastName + " expired",
+				Heading: "Your appointment request expired",
+				Lines: []string{
+					fmt.Sprintf("Dr. %s %s did not confirm your request for %s in time, so it was cancelled.", appt.Doctor.User.FirstName, appt.Doctor.User.LastName, formatLocal(appt.AppointmentDate, appt.Patient.TimeZone, "Monday 02 January 2006 at 15:04")),
+					"You can request another time in CareFlow.",
+				},
+			})
+		}
+	}()
+}
+
+// flags the appointments that are over but were never completed or marked as no-show
+func flagAwaitingClosure(appointments []models.Appointment) {
+	now := time.Now()
+	for i := range appointments {
+		appointments[i].AwaitingClosure = isAwaitingClosure(appointments[i], now)
+	}
+}
+
+// confirmed, checked in or started, and already over
+func isAwaitingClosure(appt models.Appointment, now time.Time) bool {
+	if appt.EndsAt.After(now) {
+		return false
+	}
+	for _, status := range awaitingClosureStatuses {
+		if appt.Status == status {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+)
+
+var ErrInvalidTransition = errors.New("Invalid status change")
+
+type CancelAppointmentRequest struct {
+	ReasonCode string `json:"reasonCode" validate:"required,oneof=illness schedule_conflict feeling_better doctor_unavailable emergency other"`
+	// free text, required with the 'other' code
+	Reason string `json:"reason" validate:"required_if=ReasonCode other,max=1000"`
+}
+
+// user (or the system) changing an appointment
+type Actor struct {
+	UserID uint
+	Role   string
+}
+
+// checks that only depend on the appointment and the time, on top of the transition table.
+// loc is the doctor's zone, the day of a check-in is the doctor's
+func checkTransitionGuards(appt *models.Appointment, to string, now time.Time, loc *time.Location) error {
+	switch to {
+	case models.StatusCompleted:
+		// a patient seen early can be completed before the booked time
+		if appt.Status != models.StatusInProgress && appt.AppointmentDate.After(now) {
+			return errors.New("Cannot complete an appointment that has not taken place yet")
+		}
+	case models.StatusCheckedIn:
+		if !startOfDay(now, loc).Equal(startOfDay(appt.AppointmentDate, loc)) {
+			return errors.New("Check-in is only possible on the day of the appointment")
+		}
+	case models.StatusNoShow:
+		if appt.AppointmentDate.After(now) {
+			return errors.New("Cannot mark a no-show before the appointment time")
+		}
+	}
+	return nil
+}
+
+func recordStatusChange(tx *gorm.DB, appointmentID uint, from, to string, actor Actor, reason string) error {
+	entry := models.AppointmentStatusHistory{
+		AppointmentID: appointmentID,
+		FromStatus:    from,
+		ToStatus:      to,
+		ActorRole:     actor.Role,
+		Reason:        reason,
+	}
+	if actor.UserID != 0 {
+		entry.ActorID = &actor.UserID
+	}
+	return tx.Create(&entry).Error
+}
+
+// moves the appointment to a new status and records it in the history
+func transitionAppointment(tx *gorm.DB, appt *models.Appointment, to string, actor Actor, reason string) error {
+	if !models.CanTransition(appt.Status, to, actor.Role) {
+		return fmt.Errorf("%w: cannot go from '%s' to '%s'", ErrInvalidTransition, appt.Status, to)
+	}
+	if err := checkTransitionGuards(appt, to, time.Now(), doctorLocation(tx, appt.DoctorID)); err != nil {
+		return err
+	}
+
+	from := appt.Status
+	appt.Status = to
+
+	now := time.Now()
+	switch to {
+	case models.StatusCheckedIn:
+		appt.CheckedInAt = &now
+	case models.StatusInProgress:
+		appt.StartedAt = &now
+	case models.StatusConfirmed:
+		// check-in undone
+		appt.CheckedInAt = nil
+	}
+	if err := tx.Save(appt).Error; err != nil {
+		return err
+	}
+	if from == models.StatusRescheduleProposed {
+		if err := closeOpenProposals(tx, appt.ID); err != nil {
+			return err
+		}
+	}
+	return recordStatusChange(tx, appt.ID, from, to, actor, reason)
+}
+
+func isActiveStatus(status string) bool {
+	for _, active := range models.ActiveStatuses {
+		if status == active {
+			return true
+		}
+	}
+	return false
+}
+
+// status history of an appointment the actor is part of (admins see everything)
+func GetAppointmentHistory(appointmentID uint, actor Actor) ([]models.AppointmentStatusHistory, error) {
+	if err := ensureAppointmentAccess(appointmentID, actor); err != nil {
+		return nil, err
+	}
+
+	var history []models.AppointmentStatusHistory
+	err := db.Db.Where("appointment_id = ?", appointmentID).
+		Order("created_at, id").
+		Find(&history).Error
+
+	loc := userLocation(actor.UserID)
+	for i := range history {
+		history[i].CreatedAt = history[i].CreatedAt.In(loc)
+	}
+	return history, err
+}
@@ -0,0 +1,49 @@
+package queries
+
+import (
+	"testing"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db/models"
+)
+
+func TestCheckTransitionGuards(t *testing.T) {
+	tunis, err := time.LoadLocation("Africa/Tunis")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 23:30 in Tunis, already the next day in UTC
+	now := time.Date(2026, 3, 10, 22, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		status  string
+		date    time.Time
+		to      string
+		loc     *time.Location
+		wantErr bool
+	}{
+		{"complete a past visit", models.StatusConfirmed, now.Add(-time.Hour), models.StatusCompleted, time.UTC, false},
+		{"complete a future visit", models.StatusConfirmed, now.Add(time.Hour), models.StatusCompleted, time.UTC, true},
+		{"complete a visit started early", models.StatusInProgress, now.Add(time.Hour), models.StatusCompleted, time.UTC, false},
+		{"no-show after the time", models.StatusConfirmed, now.Add(-time.Minute), models.StatusNoShow, time.UTC, false},
+		{"no-show before the time", models.StatusConfirmed, now.Add(time.Minute), models.StatusNoShow, time.UTC, true},
+		{"check in the same day", models.StatusConfirmed, now.Add(-10 * time.Hour), models.StatusCheckedIn, time.UTC, false},
+		{"check in the day before", models.StatusConfirmed, now.Add(24 * time.Hour), models.StatusCheckedIn, time.UTC, true},
+		{"check in past midnight", models.StatusConfirmed, now.Add(2 * time.Hour), models.StatusCheckedIn, time.UTC, true},
+		// 03:30 in Tunis, the same day as now there
+		{"check in on the doctor's day", models.StatusConfirmed, now.Add(-20 * time.Hour), models.StatusCheckedIn, tunis, false},
+		{"check in past midnight in the doctor's zone", models.StatusConfirmed, now.Add(2 * time.Hour), models.StatusCheckedIn, tunis, true},
+		{"cancel has no guard", models.StatusConfirmed, now.Add(time.Hour), models.StatusCancelled, time.UTC, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			appt := models.Appointment{Status: tt.status, AppointmentDate: tt.date}
+			err := checkTransitionGuards(&appt, tt.to, now, tt.loc)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkTransitionGuards() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package queries
+
+import (
+	"errors"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+)
+
+var ErrAppointmentTypeNotFound = errors.New("Appointment type not found")
+
+type AppointmentTypeBody struct {
+	Name            string  `json:"name" validate:"required,max=100"`
+	DurationMinutes int     `json:"durationMinutes" validate:"required,min=5,max=480"`
+	Fee             float64 `json:"fee" validate:"gte=0"`
+	Mode            string  `json:"mode" validate:"required,oneof=in_person video"`
+	IsActive        *bool   `json:"isActive"`
+}
+
+func GetDoctorAppointmentTypes(userID uint) ([]models.AppointmentType, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var types []models.AppointmentType
+	err = db.Db.Where("doctor_id = ?", doctorID).Order("name").Find(&types).Error
+	return types, err
+}
+
+// active types of a verified doctor, what patients can pick from
+func GetPublicAppointmentTypes(doctorID uint) ([]models.AppointmentType, error) {
+	var doctor models.Doctor
+	if err := db.Db.Where("id = ? AND is_verified = ?", doctorID, true).First(&doctor).Error; err != nil {
+		return nil, errors.New("Doctor not found")
+	}
+
+	var types []models.AppointmentType
+	err := db.Db.Where("doctor_id = ? AND is_active = ?", doctor.ID, true).Order("name").Find(&types).Error
+	return types, err
+}
+
+func CreateAppointmentType(userID uint, body AppointmentTypeBody) (*models.AppointmentType, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	appointmentType := models.AppointmentType{
+		DoctorID:        doctorID,
+		Name:            body.Name,
+		DurationMinutes: body.DurationMinutes,
+		Fee:             body.Fee,
+		Mode:            body.Mode,
+		IsActive:        body.IsActive == nil || *body.IsActive,
+	}
+	if err := db.Db.Create(&appointmentType).Error; err != nil {
+		return nil, err
+	}
+	return &appointmentType, nil
+}
+
+// existing appointments keep the duration and fee they were booked with
+func UpdateAppointmentType(userID uint, typeID uint, body AppointmentTypeBody) (*models.AppointmentType, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var appointmentType models.AppointmentType
+	if err := db.Db.Where("id = ? AND doctor_id = ?", typeID, doctorID).First(&appointmentType).Error; err != nil {
+		return nil, ErrAppointmentTypeNotFound
+	}
+
+	appointmentType.Name = body.Name
+	appointmentType.DurationMinutes = body.DurationMinutes
+	appointmentType.Fee = body.Fee
+	appointmentType.Mode = body.Mode
+	if body.IsActive != nil {
+		appointmentType.IsActive = *body.IsActive
+	}
+
+	if err := db.Db.Save(&appointmentType).Error; err != nil {
+		return nil, err
+	}
+	return &appointmentType, nil
+}
+
+func DeleteAppointmentType(userID uint, typeID uint) error {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return err
+	}
+
+	result := db.Db.Where("id = ? AND doctor_id = ?", typeID, doctorID).Delete(&models.AppointmentType{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAppointmentTypeNotFound
+	}
+	return nil
+}
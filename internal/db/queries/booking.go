@@ -0,0 +1,168 @@
+package queries
+
+import (
+	"errors"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrSlotTaken = errors.New("This time slot is already booked")
+
+// everything needed to create an appointment
+type booking struct {
+	PatientID   uint
+	DependentID *uint
+	DoctorID    uint
+	Date        time.Time
+	Reason      string
+	Type        *models.AppointmentType
+	SeriesID    *uint
+	// location asked for by the patient, must match the schedule block of the slot
+	LocationID *uint
+}
+
+// locks the doctor row so that concurrent bookings for the same doctor run one after another
+func lockDoctor(tx *gorm.DB, doctorID uint) (*models.Doctor, error) {
+	var doctor models.Doctor
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&doctor, doctorID).Error; err != nil {
+		return nil, errors.New("Doctor not found")
+	}
+	return &doctor, nil
+}
+
+// fails with ErrSlotTaken if another active appointment, a held waitlist offer or a busy time
+// of the doctor's external calendar overlaps the slot, must be called after lockDoctor inside the same transaction
+func ensureSlotFree(tx *gorm.DB, doctorID uint, slot Slot, excludeIDs ...uint) error {
+	query := tx.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND status IN ?", doctorID, models.ActiveStatuses).
+		Where("appointment_date < ? AND ends_at > ?", slot.EndsAt, slot.StartsAt)
+	if len(excludeIDs) > 0 {
+		query = query.Where("id NOT IN ?", excludeIDs)
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSlotTaken
+	}
+
+	// slots offered to a waitlisted patient stay held until the offer expires
+	err = tx.Model(&models.WaitlistEntry{}).
+		Where("doctor_id = ? AND status = ? AND offer_expires_at > ?", doctorID, models.WaitlistOffered, time.Now()).
+		Where("offered_slot < ? AND offered_slot_end > ?", slot.EndsAt, slot.StartsAt).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSlotTaken
+	}
+
+	err = tx.Model(&models.ExternalBusyBlock{}).
+		Where("doctor_id = ? AND starts_at < ? AND ends_at > ?", doctorID, slot.EndsAt, slot.StartsAt).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrSlotTaken
+	}
+	return nil
+}
+
+// turns a violation of the no-overlap constraint into ErrSlotTaken
+func bookingError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23P01" && pgErr.ConstraintName == models.NoOverlapConstraint {
+		return ErrSlotTaken
+	}
+	return err
+}
+
+// active appointment type of the doctor, nil when no type was requested
+func resolveAppointmentType(tx *gorm.DB, doctorID uint, typeID *uint) (*models.AppointmentType, error) {
+	if typeID == nil {
+		return nil, nil
+	}
+
+	var appointmentType models.AppointmentType
+	err := tx.Where("id = ? AND doctor_id = ? AND is_active = ?", *typeID, doctorID, true).First(&appointmentType).Error
+	if err != nil {
+		return nil, errors.New("Appointment type not found for this doctor")
+	}
+	return &appointmentType, nil
+}
+
+// checks schedule and conflicts for an appointment of the given length (0 uses the schedule slot length)
+func reserveSlot(tx *gorm.DB, doctorID uint, at time.Time, duration time.Duration, excludeIDs ...uint) (*models.Doctor, *Slot, error) {
+	doctor, err := lockDoctor(tx, doctorID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	slot, err := validateAppointmentTime(tx, doctor.ID, at, duration)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := ensureNotOnTimeOff(tx, doctor.ID, *slot); err != nil {
+		return nil, nil, err
+	}
+
+	if err := ensureSlotFree(tx, doctor.ID, *slot, excludeIDs...); err != nil {
+		return nil, nil, err
+	}
+	return doctor, slot, nil
+}
+
+// creates a pending appointment after the schedule and conflict checks
+func bookAppointment(tx *gorm.DB, b booking) (*models.Appointment, error) {
+	var duration time.Duration
+	if b.Type != nil {
+		duration = time.Duration(b.Type.DurationMinutes) * time.Minute
+	}
+
+	doctor, slot, err := reserveSlot(tx, b.DoctorID, b.Date, duration)
+	if err != nil {
+		return nil, err
+	}
+	if b.LocationID != nil && (slot.LocationID == nil || *slot.LocationID != *b.LocationID) {
+		return nil, ErrWrongLocation
+	}
+
+	appointment := models.Appointment{
+		PatientID:       b.PatientID,
+		DependentID:     b.DependentID,
+		DoctorID:        doctor.ID,
+		AppointmentDate: slot.StartsAt,
+		EndsAt:          slot.EndsAt,
+		DurationMinutes: int(slot.EndsAt.Sub(slot.StartsAt).Minutes()),
+		Fee:             doctor.ConsultationFee,
+		Reason:          b.Reason,
+		Status:          models.StatusPending,
+		SeriesID:        b.SeriesID,
+		LocationID:      slot.LocationID,
+	}
+	if b.Type != nil {
+		appointment.AppointmentTypeID = &b.Type.ID
+		appointment.Fee = b.Type.Fee
+	}
+
+	if err := tx.Create(&appointment).Error; err != nil {
+		return nil, err
+	}
+
+	actor := Actor{UserID: b.PatientID, Role: models.ActorPatient}
+	if err := recordStatusChange(tx, appointment.ID, "", models.StatusPending, actor, ""); err != nil {
+		return nil, err
+	}
+
+	appointment.AppointmentType = b.Type
+	return &appointment, nil
+}
@@ -0,0 +1,136 @@
+package queries
+
+import (
+	"errors"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrBookingBlocked      = errors.New("Booking is blocked because of too many missed appointments")
+	ErrCancellationTooLate = errors.New("It is too late to cancel this appointment online, please contact the doctor")
+)
+
+type UpdateBookingPolicyBody struct {
+	MaxNoShows       *int `json:"maxNoShows" validate:"omitempty,gte=0"`
+	NoShowWindowDays *int `json:"noShowWindowDays" validate:"omitempty,gte=0"`
+
+	WaitlistOfferMinutes *int `json:"waitlistOfferMinutes" validate:"omitempty,min=5"`
+
+	RescheduleProposalHours *int `json:"rescheduleProposalHours" validate:"omitempty,min=1"`
+
+	PendingExpiryHours *int `json:"pendingExpiryHours" validate:"omitempty,gte=0"`
+
+	MinCancelNoticeHours   *int  `json:"minCancelNoticeHours" validate:"omitempty,gte=0"`
+	BlockLateCancellations *bool `json:"blockLateCancellations"`
+}
+
+func getBookingPolicy(tx *gorm.DB) (*models.BookingPolicy, error) {
+	var policy models.BookingPolicy
+	if err := tx.FirstOrCreate(&policy, models.BookingPolicy{ID: 1}).Error; err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func GetBookingPolicy() (*models.BookingPolicy, error) {
+	return getBookingPolicy(db.Db)
+}
+
+func UpdateBookingPolicy(body UpdateBookingPolicyBody) (*models.BookingPolicy, error) {
+	policy, err := getBookingPolicy(db.Db)
+	if err != nil {
+		return nil, err
+	}
+
+	if body.MaxNoShows != nil {
+		policy.MaxNoShows = *body.MaxNoShows
+	}
+	if body.NoShowWindowDays != nil {
+		policy.NoShowWindowDays = *body.NoShowWindowDays
+	}
+	if body.WaitlistOfferMinutes != nil {
+		policy.WaitlistOfferMinutes = *body.WaitlistOfferMinutes
+	}
+	if body.RescheduleProposalHours != nil {
+		policy.RescheduleProposalHours = *body.RescheduleProposalHours
+	}
+	if body.PendingExpiryHours != nil {
+		policy.PendingExpiryHours = *body.PendingExpiryHours
+	}
+	if body.MinCancelNoticeHours != nil {
+		policy.MinCancelNoticeHours = *body.MinCancelNoticeHours
+	}
+	if body.BlockLateCancellations != nil {
+		policy.BlockLateCancellations = *body.BlockLateCancellations
+	}
+
+	if err := db.Db.Save(policy).Error; err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// no-shows of a patient, optionally limited to the last windowDays days
+func countNoShows(tx *gorm.DB, patientID uint, windowDays int) (int64, error) {
+	query := tx.Model(&models.Appointment{}).
+		Where("patient_id = ? AND status = ?", patientID, models.StatusNoShow)
+
+	if windowDays > 0 {
+		query = query.Where("appointment_date >= ?", time.Now().AddDate(0, 0, -windowDays))
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// applies the admin no-show rule before a patient books
+func ensureCanBook(tx *gorm.DB, patientID uint) error {
+	policy, err := getBookingPolicy(tx)
+	if err != nil {
+		return err
+	}
+	if policy.MaxNoShows == 0 {
+		return nil
+	}
+
+	count, err := countNoShows(tx, patientID, policy.NoShowWindowDays)
+	if err != nil {
+		return err
+	}
+	if count >= int64(policy.MaxNoShows) {
+		return ErrBookingBlocked
+	}
+	return nil
+}
+
+// fills the cancellation details of the appointment and flags it when the notice is too short,
+// patients are refused inside the notice window when the policy blocks late cancellations.
+// Appointments the doctor asked to move are never late
+func applyCancellationPolicy(policy *models.BookingPolicy, appt *models.Appointment, actor Actor, req CancelAppointmentRequest) error {
+	systemReason := req.ReasonCode == models.CancelReasonDeclinedReschedule || req.ReasonCode == models.CancelReasonExpired
+	doctorMoved := appt.Status == models.StatusNeedsReschedule || appt.Status == models.StatusRescheduleProposed
+
+	late := false
+	if policy.MinCancelNoticeHours > 0 && !systemReason && !doctorMoved {
+		late = time.Until(appt.AppointmentDate) < time.Duration(policy.MinCancelNoticeHours)*time.Hour
+	}
+	if late && policy.BlockLateCancellations && actor.Role == models.ActorPatient {
+		return ErrCancellationTooLate
+	}
+
+	now := time.Now()
+	appt.CancellationReasonCode = req.ReasonCode
+	appt.CancellationNote = req.Reason
+	appt.CancelledByRole = actor.Role
+	appt.CancelledAt = &now
+	appt.LateCancellation = late
+	if actor.UserID != 0 {
+		appt.CancelledByID = &actor.UserID
+	}
+	return nil
+}
@@ -0,0 +1,207 @@
+package queries
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/config"
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/pkg/ical"
+)
+
+var ErrCalendarFeedNotFound = errors.New("Calendar feed not found")
+
+// appointments older than this are left out of the feeds
+const calendarFeedHistoryDays = 90
+
+// the token and url are only known when the feed is created or rotated, only a hash of the
+// token is stored
+type CalendarFeedResponse struct {
+	Active bool   `json:"active"`
+	Token  string `json:"token,omitempty"`
+	URL    string `json:"url,omitempty"`
+}
+
+// appointment statuses shown in calendars, cancelled and missed ones stay so that apps
+// remove them and past visits stay in the history
+var calendarStatuses = map[string]string{
+	models.StatusPending:            ical.StatusTentative,
+	models.StatusConfirmed:          ical.StatusConfirmed,
+	models.StatusNeedsReschedule:    ical.StatusTentative,
+	models.StatusRescheduleProposed: ical.StatusTentative,
+	models.StatusCancelled:          ical.StatusCancelled,
+	models.StatusCheckedIn:          ical.StatusConfirmed,
+	models.StatusInProgress:         ical.StatusConfirmed,
+	models.StatusCompleted:          ical.StatusConfirmed,
+	models.StatusNoShow:             ical.StatusCancelled,
+}
+
+func newFeedToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashFeedToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// the url is absolute when API_URL is set
+func calendarFeedResponse(token string) *CalendarFeedResponse {
+	path := "/public/calendar/" + token + ".ics"
+	base, err := config.GetEnv("API_URL")
+	if err != nil {
+		return &CalendarFeedResponse{Active: true, Token: token, URL: path}
+	}
+	return &CalendarFeedResponse{Active: true, Token: token, URL: strings.TrimRight(base, "/") + path}
+}
+
+// feed url of the user, the token is created the first time it is asked for. Afterwards only
+// rotating it gives a new url
+func GetCalendarFeed(userID uint) (*CalendarFeedResponse, error) {
+	var user models.User
+	if err := db.Db.First(&user, userID).Error; err != nil {
+		return nil, errors.New("user not found")
+	}
+	if user.CalendarFeedTokenHash != nil {
+		return &CalendarFeedResponse{Active: true}, nil
+	}
+	return RotateCalendarFeed(userID)
+}
+
+// replaces the feed token, the previous url stops working
+func RotateCalendarFeed(userID uint) (*CalendarFeedResponse, error) {
+	token, err := newFeedToken()
+	if err != nil {
+		return nil, err
+	}
+
+	result := db.Db.Model(&models.User{}).Where("id = ?", userID).Update("calendar_feed_token_hash", hashFeedToken(token))
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, errors.New("user not found")
+	}
+	return calendarFeedResponse(token), nil
+}
+
+// uid shared by every export of the appointment so that calendar apps update it in place
+func AppointmentUID(appointmentID uint) string {
+	return fmt.Sprintf("appointment-%d@careflow", appointmentID)
+}
+
+// calendar event of an appointment as seen by the doctor or by the patient
+func appointmentEvent(appt models.Appointment, role string) ical.Event {
+	summary := "Appointment with Dr. " + appt.Doctor.User.FirstName + " " + appt.Doctor.User.LastName
+	if role == models.ActorDoctor {
+		summary = "Appointment with " + appt.Patient.FirstName + " " + appt.Patient.LastName
+		if appt.Dependent != nil {
+			summary = "Appointment with " + appt.Dependent.FirstName + " " + appt.Dependent.LastName
+		}
+	} else if appt.Dependent != nil {
+		summary += " for " + appt.Dependent.FirstName
+	}
+
+	var description []string
+	var location string
+	if appt.Location != nil {
+		location = locationAddress(appt.Location)
+	}
+	if appt.AppointmentType != nil {
+		summary = appt.AppointmentType.Name + ": " + strings.TrimPrefix(summary, "Appointment with ")
+		if appt.AppointmentType.Mode == models.ModeVideo {
+			location = "Video consultation"
+		}
+	}
+	if appt.Reason != "" {
+		description = append(description, "Reason: "+appt.Reason)
+	}
+	switch appt.Status {
+	case models.StatusPending:
+		description = append(description, "Waiting for the doctor's confirmation")
+	case models.StatusNeedsReschedule, models.StatusRescheduleProposed:
+		description = append(description, "This appointment is being rescheduled")
+	}
+
+	return ical.Event{
+		UID:         AppointmentUID(appt.ID),
+		Summary:     summary,
+		Description: strings.Join(description, "\n"),
+		Location:    location,
+		Start:       appt.AppointmentDate,
+		End:         appt.EndsAt,
+		Status:      calendarStatuses[appt.Status],
+		Updated:     appt.UpdatedAt,
+	}
+}
+
+func calendarStatusList() []string {
+	statuses := make([]string, 0, len(calendarStatuses))
+	for status := range calendarStatuses {
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// calendar behind a feed token, with the appointments of the doctor or the patient it belongs to
+func GetCalendarByFeedToken(token string) (*ical.Calendar, error) {
+	var user models.User
+	if err := db.Db.Where("calendar_feed_token_hash = ?", hashFeedToken(token)).First(&user).Error; err != nil {
+		return nil, ErrCalendarFeedNotFound
+	}
+
+	query := db.Db.Preload("Patient").Preload("Dependent", unscoped).Preload("Doctor.User").Preload("AppointmentType").Preload("Location").
+		Where("status IN ? AND appointment_date >= ?", calendarStatusList(), time.Now().AddDate(0, 0, -calendarFeedHistoryDays)).
+		Order("appointment_date")
+
+	switch user.Role {
+	case models.ActorDoctor:
+		doctorID, err := getDoctorID(user.ID)
+		if err != nil {
+			return nil, ErrCalendarFeedNotFound
+		}
+		query = query.Where("doctor_id = ?", doctorID)
+	case models.ActorPatient:
+		query = query.Where("patient_id = ?", user.ID)
+	default:
+		return nil, ErrCalendarFeedNotFound
+	}
+
+	var appointments []models.Appointment
+	if err := query.Find(&appointments).Error; err != nil {
+		return nil, err
+	}
+
+	calendar := &ical.Calendar{Name: "CareFlow appointments"}
+	for _, appt := range appointments {
+		calendar.Events = append(calendar.Events, appointmentEvent(appt, user.Role))
+	}
+	return calendar, nil
+}
+
+// single appointment as an iCalendar document
+func GetAppointmentCalendar(appointmentID uint, actor Actor) (*ical.Calendar, error) {
+	if err := ensureAppointmentAccess(appointmentID, actor); err != nil {
+		return nil, err
+	}
+
+	var appt models.Appointment
+	err := db.Db.Preload("Patient").Preload("Dependent", unscoped).Preload("Doctor.User").Preload("AppointmentType").Preload("Location").
+		First(&appt, appointmentID).Error
+	if err != nil {
+		return nil, ErrAppointmentNotFound
+	}
+
+	return &ical.Calendar{Events: []ical.Event{appointmentEvent(appt, actor.Role)}}, nil
+}
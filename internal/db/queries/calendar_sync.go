@@ -0,0 +1,278 @@
+package queries
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/pkg/auth"
+	"github.com/YahiaJouini/careflow/pkg/caldav"
+	"github.com/YahiaJouini/careflow/pkg/ical"
+	"gorm.io/gorm"
+)
+
+var ErrCalendarSyncNotConfigured = errors.New("Calendar sync is not configured")
+
+// how far ahead busy times are pulled from external calendars
+const calendarSyncDays = 60
+
+type CalendarSyncBody struct {
+	URL      string `json:"url" validate:"required,url"`
+	Username string `json:"username"`
+	// left out to keep the stored password
+	Password *string `json:"password"`
+	Enabled  *bool   `json:"enabled"`
+}
+
+func findCalendarSync(userID uint) (*models.CalendarSyncConfig, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var config models.CalendarSyncConfig
+	if err := db.Db.Where("doctor_id = ?", doctorID).First(&config).Error; err != nil {
+		return nil, ErrCalendarSyncNotConfigured
+	}
+	return &config, nil
+}
+
+func GetCalendarSync(userID uint) (*models.CalendarSyncConfig, error) {
+	return findCalendarSync(userID)
+}
+
+func UpdateCalendarSync(userID uint, body CalendarSyncBody) (*models.CalendarSyncConfig, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := caldav.ValidateURL(ctx, body.URL); err != nil {
+		return nil, err
+	}
+
+	var password string
+	if body.Password != nil {
+		if password, err = auth.EncryptSecret(*body.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	var config models.CalendarSyncConfig
+	err = db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("doctor_id = ?", doctorID).FirstOrInit(&config, models.CalendarSyncConfig{DoctorID: doctorID, Enabled: true}).Error; err != nil {
+			return err
+		}
+
+		// another calendar: push every appointment again and forget the old busy times
+		if config.URL != body.URL {
+			config.LastPushedAt = nil
+			if err := forgetCalendar(tx, doctorID); err != nil {
+				return err
+			}
+		}
+
+		config.URL = body.URL
+		config.Username = body.Username
+		if body.Password != nil {
+			config.Password = password
+		}
+		if body.Enabled != nil {
+			config.Enabled = *body.Enabled
+		}
+		return tx.Save(&config).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// stops the sync, busy times pulled so far no longer block booking
+func DeleteCalendarSync(userID uint) error {
+	config, err := findCalendarSync(userID)
+	if err != nil {
+		return err
+	}
+
+	return db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := forgetCalendar(tx, config.DoctorID); err != nil {
+			return err
+		}
+		return tx.Delete(config).Error
+	})
+}
+
+// drops what was pulled from and pushed to the doctor's calendar
+func forgetCalendar(tx *gorm.DB, doctorID uint) error {
+	if err := tx.Where("doctor_id = ?", doctorID).Delete(&models.ExternalBusyBlock{}).Error; err != nil {
+		return err
+	}
+	return tx.Where("doctor_id = ?", doctorID).Delete(&models.CalendarPushedEvent{}).Error
+}
+
+// runs a sync right away instead of waiting for the periodic job
+func SyncDoctorCalendar(userID uint) (*models.CalendarSyncConfig, error) {
+	config, err := findCalendarSync(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := syncCalendar(config); err != nil {
+		return config, err
+	}
+	return config, nil
+}
+
+// syncs every enabled calendar, failures are stored on each config
+func SyncCalendars() error {
+	var configs []models.CalendarSyncConfig
+	if err := db.Db.Where("enabled = ?", true).Find(&configs).Error; err != nil {
+		return err
+	}
+
+	for i := range configs {
+		if err := syncCalendar(&configs[i]); err != nil {
+			log.Println("calendar sync of doctor", configs[i].DoctorID, "failed:", err)
+		}
+	}
+	return nil
+}
+
+func syncCalendar(config *models.CalendarSyncConfig) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
+	defer cancel()
+
+	startedAt := time.Now()
+
+	// also checked when connecting, the host may resolve differently since it was saved
+	err := caldav.ValidateURL(ctx, config.URL)
+	var password string
+	if err == nil {
+		password, err = auth.DecryptSecret(config.Password)
+	}
+
+	client := caldav.NewClient(config.URL, config.Username, password)
+	if err == nil {
+		err = pushAppointments(ctx, client, config)
+	}
+	if err == nil {
+		err = pullBusyTimes(ctx, client, config.DoctorID)
+	}
+
+	updates := map[string]interface{}{"last_synced_at": startedAt, "last_error": ""}
+	if err != nil {
+		updates["last_error"] = err.Error()
+	} else {
+		// a failed push is retried from the same point next time
+		updates["last_pushed_at"] = startedAt
+	}
+	if saveErr := db.Db.Model(config).Updates(updates).Error; saveErr != nil {
+		return saveErr
+	}
+	return err
+}
+
+// writes the appointments changed since the last push to the external calendar
+func pushAppointments(ctx context.Context, client *caldav.Client, config *models.CalendarSyncConfig) error {
+	query := db.Db.Unscoped().Preload("Patient").Preload("Dependent", unscoped).Preload("Doctor.User").Preload("AppointmentType").Preload("Location").
+		Where("doctor_id = ?", config.DoctorID)
+	if config.LastPushedAt != nil {
+		query = query.Where("(updated_at > ? OR deleted_at > ?)", *config.LastPushedAt, *config.LastPushedAt)
+	} else {
+		// first push, only what is still to come
+		query = query.Where("ends_at > ? AND deleted_at IS NULL AND status <> ?", time.Now(), models.StatusCancelled)
+	}
+
+	var appointments []models.Appointment
+	if err := query.Find(&appointments).Error; err != nil {
+		return err
+	}
+
+	for _, appt := range appointments {
+		if appt.DeletedAt.Valid || appt.Status == models.StatusCancelled {
+			if err := deletePushedEvent(ctx, client, config.DoctorID, appt.ID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		calendar := &ical.Calendar{Events: []ical.Event{appointmentEvent(appt, models.ActorDoctor)}}
+		if err := client.PutEvent(ctx, AppointmentUID(appt.ID), calendar); err != nil {
+			return err
+		}
+		pushed := models.CalendarPushedEvent{DoctorID: config.DoctorID, AppointmentID: appt.ID}
+		if err := db.Db.Where(pushed).FirstOrCreate(&pushed).Error; err != nil {
+			return err
+		}
+	}
+
+	// events of appointments given to another doctor or removed for good
+	var stale []models.CalendarPushedEvent
+	err := db.Db.Joins("LEFT JOIN appointments ON appointments.id = calendar_pushed_events.appointment_id").
+		Where("calendar_pushed_events.doctor_id = ? AND (appointments.id IS NULL OR appointments.doctor_id <> ?)", config.DoctorID, config.DoctorID).
+		Find(&stale).Error
+	if err != nil {
+		return err
+	}
+	for _, event := range stale {
+		if err := deletePushedEvent(ctx, client, config.DoctorID, event.AppointmentID); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func deletePushedEvent(ctx context.Context, client *caldav.Client, doctorID uint, appointmentID uint) error {
+	if err := client.DeleteEvent(ctx, AppointmentUID(appointmentID)); err != nil {
+		return err
+	}
+	return db.Db.Where("doctor_id = ? AND appointment_id = ?", doctorID, appointmentID).Delete(&models.CalendarPushedEvent{}).Error
+}
+
+// replaces the doctor's busy blocks with the events of the external calendar
+func pullBusyTimes(ctx context.Context, client *caldav.Client, doctorID uint) error {
+	from := time.Now()
+	to := from.AddDate(0, 0, calendarSyncDays)
+
+	events, err := client.Events(ctx, from, to, doctorLocation(db.Db, doctorID))
+	if err != nil {
+		return err
+	}
+
+	var blocks []models.ExternalBusyBlock
+	for _, event := range events {
+		// our own appointments come back from the calendar, they are already booked
+		if isAppointmentUID(event.UID) || event.Status == ical.StatusCancelled || event.Transparent {
+			continue
+		}
+		if !event.End.After(event.Start) || !event.End.After(from) || !event.Start.Before(to) {
+			continue
+		}
+		blocks = append(blocks, models.ExternalBusyBlock{
+			DoctorID: doctorID,
+			UID:      event.UID,
+			StartsAt: event.Start,
+			EndsAt:   event.End,
+		})
+	}
+
+	return db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("doctor_id = ?", doctorID).Delete(&models.ExternalBusyBlock{}).Error; err != nil {
+			return err
+		}
+		if len(blocks) == 0 {
+			return nil
+		}
+		return tx.Create(&blocks).Error
+	})
+}
+
+func isAppointmentUID(uid string) bool {
+	return strings.HasPrefix(uid, "appointment-") && strings.HasSuffix(uid, "@careflow")
+}
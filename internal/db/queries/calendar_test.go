@@ -0,0 +1,42 @@
+package queries
+
+import (
+	"testing"
+
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/pkg/ical"
+)
+
+func TestAppointmentEventStatus(t *testing.T) {
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{models.StatusPending, ical.StatusTentative},
+		{models.StatusConfirmed, ical.StatusConfirmed},
+		{models.StatusNeedsReschedule, ical.StatusTentative},
+		{models.StatusRescheduleProposed, ical.StatusTentative},
+		{models.StatusCheckedIn, ical.StatusConfirmed},
+		{models.StatusInProgress, ical.StatusConfirmed},
+		// past visits keep their event instead of disappearing from the feed
+		{models.StatusCompleted, ical.StatusConfirmed},
+		{models.StatusCancelled, ical.StatusCancelled},
+		{models.StatusNoShow, ical.StatusCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.status, func(t *testing.T) {
+			event := appointmentEvent(models.Appointment{Status: tt.status}, models.ActorPatient)
+			if event.Status != tt.want {
+				t.Errorf("status = %q, want %q", event.Status, tt.want)
+			}
+		})
+	}
+
+	// every status must be in the feeds, otherwise the event stays stale in calendar apps
+	for status := range models.StatusTransitions {
+		if _, ok := calendarStatuses[status]; !ok {
+			t.Errorf("%s is missing from the calendar statuses", status)
+		}
+	}
+}
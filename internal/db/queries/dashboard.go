@@ -5,6 +5,7 @@ import (
 
 	"github.com/YahiaJouini/careflow/internal/db"
 	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
 )
 
 type AdminDashboardStats struct {
@@ -15,6 +16,10 @@ type AdminDashboardStats struct {
 
 	UsersByRole          map[string]int64 `json:"usersByRole"`          
 	AppointmentsByStatus map[string]int64 `json:"appointmentsByStatus"` 
+
+	LateCancellations         int64            `json:"lateCancellations"`
+	CancellationsByReason     map[string]int64 `json:"cancellationsByReason"`
+	LateCancellationsByReason map[string]int64 `json:"lateCancellationsByReason"`
 }
 
 type DoctorDashboardStats struct {
@@ -23,9 +28,26 @@ type DoctorDashboardStats struct {
 	UpcomingAppointments int64   `json:"upcomingAppointments"`
 	TotalPatients        int64   `json:"totalPatients"`
 	CompletedVisits      int64   `json:"completedVisits"`
+	NoShowVisits         int64   `json:"noShowVisits"`
+	LateCancellations    int64   `json:"lateCancellations"`
+	// past appointments left open, still to be completed or marked as no-show
+	AwaitingClosure int64 `json:"awaitingClosure"`
+
+	// patients of this doctor who miss the most appointments
+	FrequentNoShows []PatientNoShowCount `json:"frequentNoShows"`
 
 	AppointmentsByStatus    map[string]int64 `json:"appointmentsByStatus"`   
 	AppointmentsLast7Days   map[string]int64 `json:"appointmentsLast7Days"` 
+
+	CancellationsByReason     map[string]int64 `json:"cancellationsByReason"`
+	LateCancellationsByReason map[string]int64 `json:"lateCancellationsByReason"`
+}
+
+type PatientNoShowCount struct {
+	PatientID   uint   `json:"patientId"`
+	FirstName   string `json:"firstName"`
+	LastName    string `json:"lastName"`
+	NoShowCount int64  `json:"noShowCount"`
 }
 
 type PatientDashboardStats struct {
@@ -37,6 +59,62 @@ type PatientDashboardStats struct {
 	AppointmentsLast6Months   map[string]int64 `json:"appointmentsLast6Months"`  
 }
 
+// bucket of the by-status maps for open appointments that are already over
+const awaitingClosureBucket = "awaiting_closure"
+
+// statuses of an appointment the doctor still has to close once its time is over
+var awaitingClosureStatuses = []string{models.StatusConfirmed, models.StatusCheckedIn, models.StatusInProgress}
+
+// appointments matched by the query per status, past open ones are counted apart
+// so that "confirmed" only holds the ones still to come
+func appointmentsByStatus(query *gorm.DB) map[string]int64 {
+	counts := make(map[string]int64)
+
+	rows, err := query.
+		Select("CASE WHEN status IN ? AND ends_at <= ? THEN ? ELSE status END AS bucket, count(*)", awaitingClosureStatuses, time.Now(), awaitingClosureBucket).
+		Group("bucket").
+		Rows()
+	if err != nil {
+		return counts
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return counts
+		}
+		counts[status] = count
+	}
+	return counts
+}
+
+// cancelled appointments matched by the query, per reason code
+func cancellationsByReason(query *gorm.DB) map[string]int64 {
+	counts := make(map[string]int64)
+
+	rows, err := query.
+		Where("status = ?", models.StatusCancelled).
+		Select("COALESCE(NULLIF(cancellation_reason_code, ''), 'unspecified'), count(*)").
+		Group("cancellation_reason_code").
+		Rows()
+	if err != nil {
+		return counts
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var reason string
+		var count int64
+		if err := rows.Scan(&reason, &count); err != nil {
+			return counts
+		}
+		counts[reason] += count
+	}
+	return counts
+}
+
 func GetAdminStats() (*AdminDashboardStats, error) {
 	stats := &AdminDashboardStats{
 		UsersByRole:          make(map[string]int64),
@@ -67,16 +145,14 @@ func GetAdminStats() (*AdminDashboardStats, error) {
 		}
 	}
 
-	rows, err = db.Db.Model(&models.Appointment{}).Select("status, count(*)").Group("status").Rows()
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var status string
-			var count int64
-			rows.Scan(&status, &count)
-			stats.AppointmentsByStatus[status] = count
-		}
-	}
+	stats.AppointmentsByStatus = appointmentsByStatus(db.Db.Model(&models.Appointment{}))
+
+	db.Db.Model(&models.Appointment{}).
+		Where("status = ? AND late_cancellation = ?", models.StatusCancelled, true).
+		Count(&stats.LateCancellations)
+
+	stats.CancellationsByReason = cancellationsByReason(db.Db.Model(&models.Appointment{}))
+	stats.LateCancellationsByReason = cancellationsByReason(db.Db.Model(&models.Appointment{}).Where("late_cancellation = ?", true))
 
 	return stats, nil
 }
@@ -104,32 +180,49 @@ func GetDoctorStats(userID uint) (*DoctorDashboardStats, error) {
 		Where("doctor_id = ? AND status = ?", doctor.ID, models.StatusCompleted).
 		Count(&stats.CompletedVisits)
 
-	stats.TotalRevenue = float64(stats.CompletedVisits) * doctor.ConsultationFee
+	// each appointment keeps the fee it was booked with
+	db.Db.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND status = ?", doctor.ID, models.StatusCompleted).
+		Select("COALESCE(SUM(fee), 0)").
+		Scan(&stats.TotalRevenue)
+
+	db.Db.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND status = ?", doctor.ID, models.StatusNoShow).
+		Count(&stats.NoShowVisits)
+
+	db.Db.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND status = ? AND late_cancellation = ?", doctor.ID, models.StatusCancelled, true).
+		Count(&stats.LateCancellations)
+
+	stats.CancellationsByReason = cancellationsByReason(db.Db.Model(&models.Appointment{}).Where("doctor_id = ?", doctor.ID))
+	stats.LateCancellationsByReason = cancellationsByReason(db.Db.Model(&models.Appointment{}).Where("doctor_id = ? AND late_cancellation = ?", doctor.ID, true))
+
+	stats.FrequentNoShows = []PatientNoShowCount{}
+	db.Db.Model(&models.Appointment{}).
+		Select("users.id AS patient_id, users.first_name, users.last_name, count(*) AS no_show_count").
+		Joins("JOIN users ON users.id = appointments.patient_id").
+		Where("appointments.doctor_id = ? AND appointments.status = ?", doctor.ID, models.StatusNoShow).
+		Group("users.id, users.first_name, users.last_name").
+		Order("no_show_count DESC").
+		Limit(5).
+		Scan(&stats.FrequentNoShows)
 
 	db.Db.Model(&models.Appointment{}).
 		Where("doctor_id = ?", doctor.ID).
 		Distinct("patient_id").
 		Count(&stats.TotalPatients)
 
-	// Appointments by Status
-	rows, err := db.Db.Model(&models.Appointment{}).
-		Where("doctor_id = ?", doctor.ID).
-		Select("status, count(*)").
-		Group("status").
-		Rows()
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var status string
-			var count int64
-			rows.Scan(&status, &count)
-			stats.AppointmentsByStatus[status] = count
-		}
-	}
+	db.Db.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND status IN ? AND ends_at <= ?", doctor.ID, awaitingClosureStatuses, time.Now()).
+		Count(&stats.AwaitingClosure)
 
-	rows, err = db.Db.Model(&models.Appointment{}).
-		Where("doctor_id = ? AND appointment_date >= ?", doctor.ID, time.Now().AddDate(0, 0, -7)).
-		Select("to_char(appointment_date, 'YYYY-MM-DD') as date, count(*)").
+	stats.AppointmentsByStatus = appointmentsByStatus(db.Db.Model(&models.Appointment{}).Where("doctor_id = ?", doctor.ID))
+
+	// days are the viewer's days, not the database's
+	loc := userLocation(userID)
+	rows, err := db.Db.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND appointment_date >= ?", doctor.ID, startOfDay(time.Now(), loc).AddDate(0, 0, -6)).
+		Select("to_char(appointment_date AT TIME ZONE ?, 'YYYY-MM-DD') as date, count(*)", loc.String()).
 		Group("date").
 		Rows()
 	if err == nil {
@@ -160,24 +253,14 @@ func GetPatientStats(userID uint) (*PatientDashboardStats, error) {
 	db.Db.Model(&models.Appointment{}).Where("patient_id = ? AND status = ? AND appointment_date > ?", patient.UserID, models.StatusConfirmed, time.Now()).Count(&stats.UpcomingAppointments)
 	db.Db.Model(&models.Appointment{}).Where("patient_id = ? AND status = ?", patient.UserID, models.StatusCompleted).Count(&stats.CompletedAppointments)
 
-	rows, err := db.Db.Model(&models.Appointment{}).
-		Where("patient_id = ?", patient.UserID).
-		Select("status, count(*)").
-		Group("status").
-		Rows()
-	if err == nil {
-		defer rows.Close()
-		for rows.Next() {
-			var status string
-			var count int64
-			rows.Scan(&status, &count)
-			stats.AppointmentsByStatus[status] = count
-		}
-	}
+	stats.AppointmentsByStatus = appointmentsByStatus(db.Db.Model(&models.Appointment{}).Where("patient_id = ?", patient.UserID))
 
-	rows, err = db.Db.Model(&models.Appointment{}).
-		Where("patient_id = ? AND appointment_date >= ?", patient.UserID, time.Now().AddDate(0, -6, 0)).
-		Select("to_char(appointment_date, 'YYYY-MM') as month, count(*)").
+	// months are the viewer's months, not the database's
+	loc := userLocation(userID)
+	now := time.Now().In(loc)
+	rows, err := db.Db.Model(&models.Appointment{}).
+		Where("patient_id = ? AND appointment_date >= ?", patient.UserID, time.Date(now.Year(), now.Month()-5, 1, 0, 0, 0, 0, loc)).
+		Select("to_char(appointment_date AT TIME ZONE ?, 'YYYY-MM') as month, count(*)", loc.String()).
 		Group("month").
 		Rows()
 	if err == nil {
@@ -0,0 +1,120 @@
+package queries
+
+import (
+	"errors"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+)
+
+var ErrDependentNotFound = errors.New("Dependent not found")
+
+type DependentBody struct {
+	FirstName    string    `json:"firstName" validate:"required,min=2,max=100"`
+	LastName     string    `json:"lastName" validate:"required,min=2,max=100"`
+	DateOfBirth  time.Time `json:"dateOfBirth" validate:"required"`
+	Relationship string    `json:"relationship" validate:"required,oneof=child parent spouse other"`
+
+	Height            float64  `json:"height" validate:"gte=0"`
+	Weight            float64  `json:"weight" validate:"gte=0"`
+	BloodType         string   `json:"bloodType" validate:"omitempty,oneof=A+ A- B+ B- AB+ AB- O+ O-"`
+	ChronicConditions []string `json:"chronicConditions"`
+	Allergies         []string `json:"allergies"`
+	Medications       []string `json:"medications"`
+}
+
+func applyDependentBody(dependent *models.Dependent, body DependentBody) error {
+	if body.DateOfBirth.After(time.Now()) {
+		return errors.New("dateOfBirth cannot be in the future")
+	}
+
+	dependent.FirstName = body.FirstName
+	dependent.LastName = body.LastName
+	dependent.DateOfBirth = body.DateOfBirth
+	dependent.Relationship = body.Relationship
+	dependent.Height = body.Height
+	dependent.Weight = body.Weight
+	dependent.BloodType = body.BloodType
+	dependent.ChronicConditions = body.ChronicConditions
+	dependent.Allergies = body.Allergies
+	dependent.Medications = body.Medications
+	return nil
+}
+
+func GetDependents(patientID uint) ([]models.Dependent, error) {
+	var dependents []models.Dependent
+	err := db.Db.Where("guardian_id = ?", patientID).Order("first_name, last_name").Find(&dependents).Error
+	return dependents, err
+}
+
+func CreateDependent(patientID uint, body DependentBody) (*models.Dependent, error) {
+	dependent := models.Dependent{GuardianID: patientID}
+	if err := applyDependentBody(&dependent, body); err != nil {
+		return nil, err
+	}
+
+	if err := db.Db.Create(&dependent).Error; err != nil {
+		return nil, err
+	}
+	return &dependent, nil
+}
+
+func UpdateDependent(patientID uint, dependentID uint, body DependentBody) (*models.Dependent, error) {
+	var dependent models.Dependent
+	if err := db.Db.Where("id = ? AND guardian_id = ?", dependentID, patientID).First(&dependent).Error; err != nil {
+		return nil, ErrDependentNotFound
+	}
+
+	if err := applyDependentBody(&dependent, body); err != nil {
+		return nil, err
+	}
+
+	if err := db.Db.Save(&dependent).Error; err != nil {
+		return nil, err
+	}
+	return &dependent, nil
+}
+
+// past appointments keep pointing to the removed dependent
+func DeleteDependent(patientID uint, dependentID uint) error {
+	var dependent models.Dependent
+	if err := db.Db.Where("id = ? AND guardian_id = ?", dependentID, patientID).First(&dependent).Error; err != nil {
+		return ErrDependentNotFound
+	}
+
+	var active int64
+	err := db.Db.Model(&models.Appointment{}).
+		Where("dependent_id = ? AND (status IN ? OR status = ?)", dependent.ID, models.ActiveStatuses, models.StatusNeedsReschedule).
+		Count(&active).Error
+	if err != nil {
+		return err
+	}
+	if active > 0 {
+		return errors.New("Cancel the upcoming appointments of this dependent first")
+	}
+
+	return db.Db.Delete(&dependent).Error
+}
+
+// checks that the dependent booked for belongs to the patient, nil means the patient themselves
+func resolveDependent(tx *gorm.DB, patientID uint, dependentID *uint) error {
+	if dependentID == nil {
+		return nil
+	}
+
+	var count int64
+	if err := tx.Model(&models.Dependent{}).Where("id = ? AND guardian_id = ?", *dependentID, patientID).Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrDependentNotFound
+	}
+	return nil
+}
+
+// preload condition keeping removed dependents on their past appointments
+func unscoped(tx *gorm.DB) *gorm.DB {
+	return tx.Unscoped()
+}
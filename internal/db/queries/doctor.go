@@ -6,6 +6,7 @@ import (
 
 	"github.com/YahiaJouini/careflow/internal/db"
 	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
 )
 
 type DoctorUpdateAppointmentRequest struct {
@@ -14,7 +15,8 @@ type DoctorUpdateAppointmentRequest struct {
 }
 
 type ValidateAppointmentRequest struct {
-	Status string `json:"status"` // "confirmed" or "completed"
+	Status string `json:"status"` // "confirmed", "checked_in", "in_progress", "completed" or "no_show"
+	Reason string `json:"reason"`
 }
 
 type PatientDetailsResponse struct {
@@ -28,6 +30,27 @@ type PatientDetailsResponse struct {
 	ChronicConditions []string `json:"chronicConditions"`
 	Allergies         []string `json:"allergies"`
 	Medications       []string `json:"medications"`
+	NoShowCount       int64    `json:"noShowCount"`
+
+	// set when the patient is a dependent, the contact details are then the guardian's
+	DependentID  *uint      `json:"dependentId,omitempty"`
+	DateOfBirth  *time.Time `json:"dateOfBirth,omitempty"`
+	GuardianName string     `json:"guardianName,omitempty"`
+}
+
+// someone the doctor had appointments with: a patient account or one of its dependents
+type DoctorPatient struct {
+	// user id of the account, the guardian's for a dependent
+	ID          uint       `json:"id"`
+	DependentID *uint      `json:"dependentId,omitempty"`
+	FirstName   string     `json:"firstName"`
+	LastName    string     `json:"lastName"`
+	Email       string     `json:"email"`
+	Image       string     `json:"image"`
+	DateOfBirth *time.Time `json:"dateOfBirth,omitempty"`
+
+	GuardianFirstName string `json:"guardianFirstName,omitempty"`
+	GuardianLastName  string `json:"guardianLastName,omitempty"`
 }
 
 func getDoctorID(userID uint) (uint, error) {
@@ -43,93 +66,146 @@ func GetDoctorAppointments(userID uint) ([]models.Appointment, error) {
 	if err != nil {
 		return nil, err
 	}
-
 	var appointments []models.Appointment
-	err = db.Db.Preload("Patient").
+	err = db.Db.Preload("Patient").Preload("Dependent", unscoped).Preload("AppointmentType").Preload("Location").
 		Where("doctor_id = ?", doctorID).
 		Find(&appointments).Error
 
+	localizeAppointments(appointments, userLocation(userID))
+	flagAwaitingClosure(appointments)
 	return appointments, err
 }
 
-func ValidateAppointment(userID uint, appointmentID uint, status string) (*models.Appointment, error) {
+func ValidateAppointment(userID uint, appointmentID uint, req ValidateAppointmentRequest) (*models.Appointment, error) {
 	doctorID, err := getDoctorID(userID)
 	if err != nil {
 		return nil, err
 	}
 
-	var appt models.Appointment
-	if err := db.Db.Where("id = ? AND doctor_id = ?", appointmentID, doctorID).First(&appt).Error; err != nil {
-		return nil, errors.New("Appointment not found")
-	}
-
-	if status != models.StatusConfirmed && status != models.StatusCompleted {
-		return nil, errors.New("Invalid status. Use 'confirmed' or 'completed'")
+	switch req.Status {
+	case models.StatusConfirmed, models.StatusCheckedIn, models.StatusInProgress, models.StatusCompleted, models.StatusNoShow:
+	default:
+		return nil, errors.New("Invalid status. Use 'confirmed', 'checked_in', 'in_progress', 'completed' or 'no_show'")
 	}
 
-	appt.Status = status
-	if err := db.Db.Save(&appt).Error; err != nil {
+	var appt models.Appointment
+	err = db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND doctor_id = ?", appointmentID, doctorID).First(&appt).Error; err != nil {
+			return ErrAppointmentNotFound
+		}
+		return transitionAppointment(tx, &appt, req.Status, Actor{UserID: userID, Role: models.ActorDoctor}, req.Reason)
+	})
+	if err != nil {
 		return nil, err
 	}
 
+	localizeAppointment(&appt, userLocation(userID))
 	return &appt, nil
 }
 
-func UpdateAppointmentDoctor(userID uint, appointmentID uint, req DoctorUpdateAppointmentRequest) (*models.Appointment, error) {
+func UpdateAppointmentDoctor(userID uint, appointmentID uint, req DoctorUpdateAppointmentRequest, scope string) (*models.Appointment, error) {
 	doctorID, err := getDoctorID(userID)
 	if err != nil {
 		return nil, err
 	}
 
 	var appt models.Appointment
-	if err := db.Db.Where("id = ? AND doctor_id = ?", appointmentID, doctorID).First(&appt).Error; err != nil {
-		return nil, errors.New("Appointment not found")
-	}
+	var proposalIDs []uint
+	err = db.Db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockDoctor(tx, doctorID); err != nil {
+			return err
+		}
+		if err := tx.Where("id = ? AND doctor_id = ?", appointmentID, doctorID).First(&appt).Error; err != nil {
+			return ErrAppointmentNotFound
+		}
 
-	if !req.AppointmentDate.IsZero() {
-		appt.AppointmentDate = req.AppointmentDate
-	}
-	appt.DoctorNotes = req.DoctorNotes
+		appt.DoctorNotes = req.DoctorNotes
+		if req.AppointmentDate.IsZero() || req.AppointmentDate.Equal(appt.AppointmentDate) {
+			return tx.Save(&appt).Error
+		}
 
-	if err := db.Db.Save(&appt).Error; err != nil {
-		return nil, err
+		if !isActiveStatus(appt.Status) && appt.Status != models.StatusNeedsReschedule {
+			return errors.New("Only upcoming, ongoing or to be rescheduled appointments can be rescheduled")
+		}
+
+		occurrences, err := selectOccurrences(tx, &appt, scope)
+		if err != nil {
+			return err
+		}
+		occurrences[0].DoctorNotes = req.DoctorNotes
+
+		// the patient has to accept the new time before the appointment moves
+		proposalIDs, err = proposeOccurrences(tx, occurrences, req.AppointmentDate, Actor{UserID: userID, Role: models.ActorDoctor}, "")
+		if err != nil {
+			return err
+		}
+		appt = occurrences[0]
+		return nil
+	})
+	if err != nil {
+		return nil, bookingError(err)
 	}
 
+	notifyRescheduleProposals(proposalIDs)
+	localizeAppointment(&appt, userLocation(userID))
 	return &appt, nil
 }
 
-func CancelAppointmentDoctor(userID uint, appointmentID uint) error {
+func CancelAppointmentDoctor(userID uint, appointmentID uint, req CancelAppointmentRequest, scope string) error {
 	doctorID, err := getDoctorID(userID)
 	if err != nil {
 		return err
 	}
 
-	var appt models.Appointment
-	if err := db.Db.Where("id = ? AND doctor_id = ?", appointmentID, doctorID).First(&appt).Error; err != nil {
-		return errors.New("Appointment not found")
+	var offers []models.WaitlistEntry
+	err = db.Db.Transaction(func(tx *gorm.DB) error {
+		var appt models.Appointment
+		if err := tx.Where("id = ? AND doctor_id = ?", appointmentID, doctorID).First(&appt).Error; err != nil {
+			return ErrAppointmentNotFound
+		}
+
+		occurrences, err := selectOccurrences(tx, &appt, scope)
+		if err != nil {
+			return err
+		}
+		offers, _, err = cancelOccurrences(tx, occurrences, Actor{UserID: userID, Role: models.ActorDoctor}, req)
+		return err
+	})
+	if err != nil {
+		return err
 	}
 
-	appt.Status = models.StatusCancelled
-	return db.Db.Save(&appt).Error
+	notifyWaitlistOffers(offers)
+	return nil
 }
 
-func GetDoctorPatients(userID uint) ([]models.User, error) {
+// appointments booked for a dependent count as the dependent's, not the guardian's
+func GetDoctorPatients(userID uint) ([]DoctorPatient, error) {
 	doctorID, err := getDoctorID(userID)
 	if err != nil {
 		return nil, err
 	}
 
-	var patients []models.User
+	patients := []DoctorPatient{}
 
-	err = db.Db.Model(&models.User{}).
-		Joins("JOIN appointments ON appointments.patient_id = users.id").
+	err = db.Db.Model(&models.Appointment{}).
+		Select(`users.id, appointments.dependent_id,
+			COALESCE(dependents.first_name, users.first_name) AS first_name,
+			COALESCE(dependents.last_name, users.last_name) AS last_name,
+			users.email, users.image, dependents.date_of_birth,
+			CASE WHEN dependents.id IS NULL THEN '' ELSE users.first_name END AS guardian_first_name,
+			CASE WHEN dependents.id IS NULL THEN '' ELSE users.last_name END AS guardian_last_name`).
+		Joins("JOIN users ON users.id = appointments.patient_id AND users.deleted_at IS NULL").
+		Joins("LEFT JOIN dependents ON dependents.id = appointments.dependent_id").
 		Where("appointments.doctor_id = ?", doctorID).
-		Group("users.id").
-		Find(&patients).Error
+		Group("users.id, appointments.dependent_id, dependents.id").
+		Order("last_name, first_name").
+		Scan(&patients).Error
 
 	return patients, err
 }
 
+// the patient's own record, only when the doctor saw the patient themselves and not just one of their dependents
 func GetDoctorPatientDetails(doctorUserID, patientUserID uint) (*models.Patient, error) {
 	doctorID, err := getDoctorID(doctorUserID)
 	if err != nil {
@@ -139,7 +215,7 @@ func GetDoctorPatientDetails(doctorUserID, patientUserID uint) (*models.Patient,
 	var patient models.Patient
 	err = db.Db.Preload("User").
 		Joins("JOIN appointments ON appointments.patient_id = patients.user_id").
-		Where("appointments.doctor_id = ? AND patients.user_id = ?", doctorID, patientUserID).
+		Where("appointments.doctor_id = ? AND patients.user_id = ? AND appointments.dependent_id IS NULL", doctorID, patientUserID).
 		First(&patient).Error
 
 	if err != nil {
@@ -148,3 +224,35 @@ func GetDoctorPatientDetails(doctorUserID, patientUserID uint) (*models.Patient,
 
 	return &patient, nil
 }
+
+func GetDoctorDependentDetails(doctorUserID, patientUserID, dependentID uint) (*models.Dependent, error) {
+	doctorID, err := getDoctorID(doctorUserID)
+	if err != nil {
+		return nil, err
+	}
+
+	var dependent models.Dependent
+	err = db.Db.Unscoped().Preload("Guardian").
+		Joins("JOIN appointments ON appointments.dependent_id = dependents.id").
+		Where("appointments.doctor_id = ? AND dependents.id = ? AND dependents.guardian_id = ?", doctorID, dependentID, patientUserID).
+		First(&dependent).Error
+
+	if err != nil {
+		return nil, errors.New("patient not found or not associated with this doctor")
+	}
+
+	return &dependent, nil
+}
+
+func GetPatientNoShowCount(patientUserID uint) (int64, error) {
+	return countNoShows(db.Db, patientUserID, 0)
+}
+
+// no-shows of the appointments booked for a dependent only, not the guardian's own
+func GetDependentNoShowCount(dependentID uint) (int64, error) {
+	var count int64
+	err := db.Db.Model(&models.Appointment{}).
+		Where("dependent_id = ? AND status = ?", dependentID, models.StatusNoShow).
+		Count(&count).Error
+	return count, err
+}
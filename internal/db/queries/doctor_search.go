@@ -0,0 +1,348 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// how far ahead the first free slot of a doctor is looked for
+const nextSlotLookahead = 14 * 24 * time.Hour
+
+// sort orders of the doctor search
+const (
+	SortRelevance     = "relevance"
+	SortFeeAsc        = "fee_asc"
+	SortFeeDesc       = "fee_desc"
+	SortNextAvailable = "next_available"
+	SortDistance      = "distance"
+	SortRating        = "rating"
+)
+
+// prefix query built by searchTerms
+var searchQuerySQL = fmt.Sprintf("to_tsquery('%s', ?)", models.SearchConfiguration)
+
+// weighted document of a doctor: names first, then the specialty, then the bio. It spans three
+// tables so it is computed on the fly rather than indexed
+var searchDocumentSQL = fmt.Sprintf(
+	"setweight(to_tsvector('%[1]s', %[2]s(users.first_name || ' ' || users.last_name)), 'A') || "+
+		"setweight(to_tsvector('%[1]s', %[2]s(specialties.name)), 'B') || "+
+		"setweight(to_tsvector('%[1]s', %[2]s(COALESCE(doctors.bio, ''))), 'C')",
+	models.SearchConfiguration, models.SearchFoldFunction,
+)
+
+type DoctorSearchRequest struct {
+	PublicDoctorFilter
+
+	// free text matched against names, specialty and bio
+	Query     string   `validate:"max=200"`
+	MinFee    *float64 `validate:"omitempty,gte=0"`
+	MaxFee    *float64 `validate:"omitempty,gte=0"`
+	Available *bool
+
+	Sort     string `validate:"omitempty,oneof=relevance fee_asc fee_desc next_available distance rating"`
+	Page     int    `validate:"min=1"`
+	PageSize int    `validate:"min=1,max=50"`
+}
+
+type DoctorSearchResult struct {
+	Doctors  []PublicDoctorSummary `json:"doctors"`
+	Total    int64                 `json:"total"`
+	Page     int                   `json:"page"`
+	PageSize int                   `json:"pageSize"`
+}
+
+// search result of a doctor, without the account details of the user behind it
+type PublicDoctorSummary struct {
+	ID        uint   `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Image     string `json:"image"`
+
+	Specialty          models.Specialty           `json:"specialty"`
+	Bio                string                     `json:"bio"`
+	ConsultationFee    float64                    `json:"consultationFee"`
+	AverageRating      float64                    `json:"averageRating"`
+	ReviewCount        int                        `json:"reviewCount"`
+	IsAvailable        bool                       `json:"isAvailable"`
+	TimeZone           string                     `json:"timeZone"`
+	Languages          []string                   `json:"languages"`
+	YearsOfExperience  int                        `json:"yearsOfExperience"`
+	Locations          []models.Location          `json:"locations"`
+	AcceptedInsurances []models.InsuranceProvider `json:"acceptedInsurances"`
+
+	// km from the searched point to the nearest location, only set by a nearby search
+	DistanceKm *float64 `json:"distanceKm,omitempty"`
+	// start of the first free slot in the coming weeks
+	NextAvailableAt *time.Time `json:"nextAvailableAt,omitempty"`
+}
+
+func newPublicDoctorSummary(doctor *models.Doctor) PublicDoctorSummary {
+	return PublicDoctorSummary{
+		ID:                 doctor.ID,
+		FirstName:          doctor.User.FirstName,
+		LastName:           doctor.User.LastName,
+		Image:              doctor.User.Image,
+		Specialty:          doctor.Specialty,
+		Bio:                doctor.Bio,
+		ConsultationFee:    doctor.ConsultationFee,
+		AverageRating:      doctor.AverageRating,
+		ReviewCount:        doctor.ReviewCount,
+		IsAvailable:        doctor.IsAvailable,
+		TimeZone:           doctor.TimeZone,
+		Languages:          doctor.Languages,
+		YearsOfExperience:  doctor.YearsOfExperience,
+		Locations:          doctor.Locations,
+		AcceptedInsurances: doctor.AcceptedInsurances,
+	}
+}
+
+// prefix tsquery matching every word of the text, empty when there is nothing to search.
+// Only letters and digits are kept so the text can't inject tsquery operators
+func searchTerms(text string) string {
+	var terms []string
+	for _, word := range strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	}) {
+		// arabic vowel marks and tatweel are dropped like in the indexed text
+		word = strings.Map(func(r rune) rune {
+			if unicode.Is(unicode.Mn, r) || r == '\u0640' {
+				return -1
+			}
+			return unicode.ToLower(r)
+		}, word)
+		if word != "" {
+			terms = append(terms, word+":*")
+		}
+	}
+	return strings.Join(terms, " & ")
+}
+
+// start of the first free slot in the coming weeks of each of the doctors, nil when there is
+// none. Schedules and busy times are loaded for all of them at once
+func nextAvailableSlots(doctors []models.Doctor) (map[uint]*time.Time, error) {
+	next := make(map[uint]*time.Time, len(doctors))
+	var ids []uint
+	for _, doctor := range doctors {
+		next[doctor.ID] = nil
+		if doctor.IsAvailable {
+			ids = append(ids, doctor.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return next, nil
+	}
+
+	var schedules []models.DoctorSchedule
+	if err := db.Db.Where("doctor_id IN ?", ids).Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	byDoctor := make(map[uint][]models.DoctorSchedule)
+	for _, schedule := range schedules {
+		byDoctor[schedule.DoctorID] = append(byDoctor[schedule.DoctorID], schedule)
+	}
+
+	now := time.Now()
+	to := now.Add(nextSlotLookahead)
+	busy, err := busyPeriods(ids, now.Add(-24*time.Hour), to.Add(24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, doctor := range doctors {
+		if len(byDoctor[doctor.ID]) == 0 {
+			continue
+		}
+		slots := openSlots(generateSlots(byDoctor[doctor.ID], now, to, loadLocation(doctor.TimeZone), 0), busy[doctor.ID])
+		if len(slots) > 0 {
+			next[doctor.ID] = &slots[0].StartsAt
+		}
+	}
+	return next, nil
+}
+
+// doctors with the given ids, in the same order, with what the public summary needs
+func loadDoctors(ids []uint) ([]models.Doctor, error) {
+	doctors := []models.Doctor{}
+	if len(ids) == 0 {
+		return doctors, nil
+	}
+
+	err := db.Db.Preload("User").Preload("Specialty").Preload("Locations").Preload("AcceptedInsurances").Find(&doctors, ids).Error
+	if err != nil {
+		return nil, err
+	}
+
+	position := make(map[uint]int, len(ids))
+	for i, id := range ids {
+		position[id] = i
+	}
+	sort.Slice(doctors, func(i, j int) bool { return position[doctors[i].ID] < position[doctors[j].ID] })
+	return doctors, nil
+}
+
+func SearchDoctors(req DoctorSearchRequest) (*DoctorSearchResult, error) {
+	if req.MinFee != nil && req.MaxFee != nil && *req.MinFee > *req.MaxFee {
+		return nil, errors.New("minFee cannot be greater than maxFee")
+	}
+	if req.Sort == SortDistance && req.Near == nil {
+		return nil, errors.New("Sorting by distance needs lat and lng")
+	}
+
+	terms := searchTerms(req.Query)
+	sortBy := req.Sort
+	if sortBy == "" {
+		switch {
+		case terms != "":
+			sortBy = SortRelevance
+		case req.Near != nil:
+			sortBy = SortDistance
+		}
+	}
+
+	result := &DoctorSearchResult{Doctors: []PublicDoctorSummary{}, Page: req.Page, PageSize: req.PageSize}
+
+	query := db.Db.Model(&models.Doctor{}).
+		Joins("JOIN users ON users.id = doctors.user_id AND users.deleted_at IS NULL").
+		Joins("JOIN specialties ON specialties.id = doctors.specialty_id").
+		Where("doctors.is_verified = ?", true)
+
+	if req.SpecialtyID > 0 {
+		query = query.Where("doctors.specialty_id = ?", req.SpecialtyID)
+	}
+	if req.MinFee != nil {
+		query = query.Where("doctors.consultation_fee >= ?", *req.MinFee)
+	}
+	if req.MaxFee != nil {
+		query = query.Where("doctors.consultation_fee <= ?", *req.MaxFee)
+	}
+	query = filterDoctorProfiles(query, req.PublicDoctorFilter)
+	if req.Available != nil {
+		query = query.Where("doctors.is_available = ?", *req.Available)
+	}
+	if terms != "" {
+		query = query.Where(searchDocumentSQL+" @@ "+searchQuerySQL, terms)
+	}
+
+	var distances map[uint]float64
+	if req.Near != nil {
+		nearby, err := nearbyDoctors(*req.Near, req.RadiusKm)
+		if err != nil {
+			return nil, err
+		}
+		if len(nearby) == 0 {
+			return result, nil
+		}
+
+		var ids []uint
+		ids, distances = nearbyIndex(nearby)
+		query = query.Where("doctors.id IN ?", ids)
+	}
+
+	query = query.Session(&gorm.Session{})
+	if err := query.Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+	if result.Total == 0 {
+		return result, nil
+	}
+
+	offset := (req.Page - 1) * req.PageSize
+	var nextSlots map[uint]*time.Time
+	var ids []uint
+
+	switch sortBy {
+	case SortDistance, SortNextAvailable:
+		// not columns of the table, the matches are ranked here
+		var matches []models.Doctor
+		if err := query.Select("doctors.id", "doctors.is_available", "doctors.time_zone").Find(&matches).Error; err != nil {
+			return nil, err
+		}
+
+		if sortBy == SortNextAvailable {
+			var err error
+			if nextSlots, err = nextAvailableSlots(matches); err != nil {
+				return nil, err
+			}
+		}
+
+		sort.SliceStable(matches, func(i, j int) bool {
+			a, b := matches[i].ID, matches[j].ID
+			if sortBy == SortDistance {
+				if distances[a] != distances[b] {
+					return distances[a] < distances[b]
+				}
+				return a < b
+			}
+			// doctors without a free slot come last
+			nextA, nextB := nextSlots[a], nextSlots[b]
+			switch {
+			case nextA == nil && nextB == nil:
+				return a < b
+			case nextA == nil || nextB == nil:
+				return nextB == nil
+			case !nextA.Equal(*nextB):
+				return nextA.Before(*nextB)
+			}
+			return a < b
+		})
+
+		for i := offset; i < len(matches) && i < offset+req.PageSize; i++ {
+			ids = append(ids, matches[i].ID)
+		}
+
+	default:
+		ordered := query
+		switch sortBy {
+		case SortRelevance:
+			ordered = ordered.Order(clause.OrderBy{Expression: clause.Expr{
+				SQL:                "ts_rank(" + searchDocumentSQL + ", " + searchQuerySQL + ") DESC",
+				Vars:               []interface{}{terms},
+				WithoutParentheses: true,
+			}})
+		case SortFeeAsc:
+			ordered = ordered.Order("doctors.consultation_fee ASC")
+		case SortFeeDesc:
+			ordered = ordered.Order("doctors.consultation_fee DESC")
+		case SortRating:
+			ordered = ordered.Order("doctors.average_rating DESC, doctors.review_count DESC")
+		default:
+			ordered = ordered.Order("users.last_name, users.first_name")
+		}
+
+		err := ordered.Order("doctors.id").Offset(offset).Limit(req.PageSize).Pluck("doctors.id", &ids).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	doctors, err := loadDoctors(ids)
+	if err != nil {
+		return nil, err
+	}
+	if nextSlots == nil {
+		if nextSlots, err = nextAvailableSlots(doctors); err != nil {
+			return nil, err
+		}
+	}
+
+	for i := range doctors {
+		doctor := &doctors[i]
+		summary := newPublicDoctorSummary(doctor)
+		if distance, ok := distances[doctor.ID]; ok {
+			summary.DistanceKm = &distance
+		}
+		summary.NextAvailableAt = nextSlots[doctor.ID]
+		result.Doctors = append(result.Doctors, summary)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,32 @@
+package queries
+
+import "testing"
+
+func TestSearchTerms(t *testing.T) {
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{"empty", "", ""},
+		{"only spaces", "   ", ""},
+		{"one word", "cardio", "cardio:*"},
+		{"lower cased", "Dr HOUSE", "dr:* & house:*"},
+		{"punctuation splits words", "jean-pierre, o'neil", "jean:* & pierre:* & o:* & neil:*"},
+		{"tsquery operators are dropped", "house & !wilson | (cuddy) <-> foreman:*", "house:* & wilson:* & cuddy:* & foreman:*"},
+		{"quotes are dropped", `'a' "b"`, "a:* & b:*"},
+		{"digits are kept", "clinic 24", "clinic:* & 24:*"},
+		{"accents are kept for the search configuration", "Éric Gérard", "éric:* & gérard:*"},
+		{"arabic vowel marks are dropped", "مُحَمَّد", "محمد:*"},
+		{"tatweel is dropped", "طـبيب", "طبيب:*"},
+		{"a word made of marks only", "َُ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := searchTerms(tt.text); got != tt.want {
+				t.Errorf("searchTerms(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package queries
+
+import (
+	"errors"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrIdempotencyKeyReused     = errors.New("This Idempotency-Key was already used for a different request")
+	ErrIdempotencyKeyInProgress = errors.New("A request with this Idempotency-Key is still being processed")
+)
+
+// how long a claimed key stays locked while its request runs, a crashed request frees it after that
+const IdempotencyLease = 5 * time.Minute
+
+// reserves the key for a new request. When the key is already known the stored record is
+// returned with claimed false, and the caller replays its response
+func ClaimIdempotencyKey(userID uint, key string, requestHash string, window time.Duration) (*models.IdempotencyRecord, bool, error) {
+	now := time.Now()
+	// a key past its window is free again, and so is one whose request never finished
+	err := db.Db.Where("user_id = ? AND key = ? AND (expires_at <= ? OR (completed = false AND locked_until <= ?))", userID, key, now, now).
+		Delete(&models.IdempotencyRecord{}).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	record := models.IdempotencyRecord{
+		UserID:      userID,
+		Key:         key,
+		RequestHash: requestHash,
+		LockedUntil: now.Add(IdempotencyLease),
+		ExpiresAt:   now.Add(window),
+	}
+	result := db.Db.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+	if result.Error != nil {
+		return nil, false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		return &record, true, nil
+	}
+
+	var existing models.IdempotencyRecord
+	if err := db.Db.Where("user_id = ? AND key = ?", userID, key).First(&existing).Error; err != nil {
+		return nil, false, err
+	}
+	if existing.RequestHash != requestHash {
+		return nil, false, ErrIdempotencyKeyReused
+	}
+	if !existing.Completed {
+		return nil, false, ErrIdempotencyKeyInProgress
+	}
+	return &existing, false, nil
+}
+
+func SaveIdempotentResponse(recordID uint, statusCode int, contentType string, body []byte) error {
+	return db.Db.Model(&models.IdempotencyRecord{}).Where("id = ?", recordID).Updates(map[string]interface{}{
+		"completed":    true,
+		"status_code":  statusCode,
+		"content_type": contentType,
+		"body":         body,
+	}).Error
+}
+
+// frees the key when the request failed on our side, so that a retry runs it again
+func ReleaseIdempotencyKey(recordID uint) error {
+	return db.Db.Delete(&models.IdempotencyRecord{}, recordID).Error
+}
+
+func DeleteExpiredIdempotencyRecords() error {
+	return db.Db.Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyRecord{}).Error
+}
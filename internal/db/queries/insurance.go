@@ -0,0 +1,202 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+)
+
+var ErrInsuranceProviderNotFound = errors.New("Insurance provider not found")
+
+type InsuranceProviderBody struct {
+	Name     string `json:"name" validate:"required,max=150"`
+	Kind     string `json:"kind" validate:"required,oneof=public private"`
+	Website  string `json:"website" validate:"omitempty,url,max=255"`
+	IsActive *bool  `json:"isActive"`
+}
+
+type DoctorInsurancesBody struct {
+	ProviderIDs []uint `json:"providerIds" validate:"max=50"`
+}
+
+// the whole catalog for admins, only the active providers otherwise
+func GetInsuranceProviders(activeOnly bool) ([]models.InsuranceProvider, error) {
+	query := db.Db.Order("kind, name")
+	if activeOnly {
+		query = query.Where("is_active = ?", true)
+	}
+
+	var providers []models.InsuranceProvider
+	err := query.Find(&providers).Error
+	return providers, err
+}
+
+func CreateInsuranceProvider(body InsuranceProviderBody) (*models.InsuranceProvider, error) {
+	provider := models.InsuranceProvider{
+		Name:     body.Name,
+		Kind:     body.Kind,
+		Website:  body.Website,
+		IsActive: body.IsActive == nil || *body.IsActive,
+	}
+	if err := db.Db.Create(&provider).Error; err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+func UpdateInsuranceProvider(providerID uint, body InsuranceProviderBody) (*models.InsuranceProvider, error) {
+	var provider models.InsuranceProvider
+	if err := db.Db.First(&provider, providerID).Error; err != nil {
+		return nil, ErrInsuranceProviderNotFound
+	}
+
+	provider.Name = body.Name
+	provider.Kind = body.Kind
+	provider.Website = body.Website
+	if body.IsActive != nil {
+		provider.IsActive = *body.IsActive
+	}
+
+	if err := db.Db.Save(&provider).Error; err != nil {
+		return nil, err
+	}
+	return &provider, nil
+}
+
+// only providers nobody refers to can be deleted, the others are deactivated instead
+func DeleteInsuranceProvider(providerID uint) error {
+	return db.Db.Transaction(func(tx *gorm.DB) error {
+		var provider models.InsuranceProvider
+		if err := tx.First(&provider, providerID).Error; err != nil {
+			return ErrInsuranceProviderNotFound
+		}
+
+		var doctors, patients int64
+		if err := tx.Table("doctor_insurance_providers").Where("insurance_provider_id = ?", provider.ID).Count(&doctors).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Patient{}).Where("insurance_provider_id = ?", provider.ID).Count(&patients).Error; err != nil {
+			return err
+		}
+		if doctors > 0 || patients > 0 {
+			return errors.New("This provider is still used by doctors or patients, deactivate it instead")
+		}
+
+		return tx.Delete(&provider).Error
+	})
+}
+
+// active providers with the given ids, fails if one of them is unknown or inactive
+func findActiveProviders(tx *gorm.DB, ids []uint) ([]models.InsuranceProvider, error) {
+	providers := []models.InsuranceProvider{}
+	if len(ids) == 0 {
+		return providers, nil
+	}
+
+	if err := tx.Where("id IN ? AND is_active = ?", ids, true).Find(&providers).Error; err != nil {
+		return nil, err
+	}
+
+	found := make(map[uint]bool, len(providers))
+	for _, provider := range providers {
+		found[provider.ID] = true
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return nil, fmt.Errorf("Insurance provider %d not found", id)
+		}
+	}
+	return providers, nil
+}
+
+func GetDoctorInsurances(userID uint) ([]models.InsuranceProvider, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var providers []models.InsuranceProvider
+	err = db.Db.Joins("JOIN doctor_insurance_providers ON doctor_insurance_providers.insurance_provider_id = insurance_providers.id").
+		Where("doctor_insurance_providers.doctor_id = ?", doctorID).
+		Order("insurance_providers.kind, insurance_providers.name").
+		Find(&providers).Error
+
+	return providers, err
+}
+
+// replaces the list of insurers the doctor accepts
+func SetDoctorInsurances(userID uint, body DoctorInsurancesBody) ([]models.InsuranceProvider, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Db.Transaction(func(tx *gorm.DB) error {
+		providers, err := findActiveProviders(tx, body.ProviderIDs)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.Doctor{ID: doctorID}).Association("AcceptedInsurances").Replace(providers)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetDoctorInsurances(userID)
+}
+
+// reasons a visit with the doctor at the given time may not be covered by the patient's
+// insurance, empty when the patient has none. Dependents are covered by their guardian's policy
+func coverageWarnings(tx *gorm.DB, patientID uint, dependentID *uint, doctorID uint, at time.Time) ([]string, error) {
+	var patient models.Patient
+	err := tx.Preload("InsuranceProvider").Where("user_id = ?", patientID).First(&patient).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if patient.InsuranceProvider == nil {
+		return nil, nil
+	}
+
+	provider := patient.InsuranceProvider
+	var warnings []string
+	if patient.PolicyExpiresAt != nil && policyExpiredBy(*patient.PolicyExpiresAt, at, userLocationTx(tx, patientID)) {
+		if dependentID != nil {
+			warnings = append(warnings, fmt.Sprintf("Your %s policy, used for your dependent as their guardian, expires before this appointment", provider.Name))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("Your %s policy expires before this appointment", provider.Name))
+		}
+	}
+
+	var count int64
+	err = tx.Table("doctor_insurance_providers").
+		Where("doctor_id = ? AND insurance_provider_id = ?", doctorID, provider.ID).
+		Count(&count).Error
+	if err != nil {
+		return nil, err
+	}
+	if count == 0 {
+		if dependentID != nil {
+			warnings = append(warnings, fmt.Sprintf("This doctor does not accept %s, the guardian's policy used for your dependent, the visit may not be covered", provider.Name))
+		} else {
+			warnings = append(warnings, fmt.Sprintf("This doctor does not accept %s, the visit may not be covered", provider.Name))
+		}
+	}
+	return warnings, nil
+}
+
+// whether the policy has run out by the day of the appointment. The policy covers its whole
+// expiry day, so only the calendar dates are compared, the appointment's in the patient's zone
+func policyExpiredBy(expiresAt time.Time, at time.Time, loc *time.Location) bool {
+	expiryYear, expiryMonth, expiryDay := expiresAt.Date()
+	year, month, day := at.In(loc).Date()
+
+	expiry := time.Date(expiryYear, expiryMonth, expiryDay, 0, 0, 0, 0, time.UTC)
+	return expiry.Before(time.Date(year, month, day, 0, 0, 0, 0, time.UTC))
+}
@@ -0,0 +1,203 @@
+package queries
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrLocationNotFound = errors.New("Location not found")
+	ErrWrongLocation    = errors.New("The doctor does not work at this location at that time")
+	ErrLocationReadOnly = errors.New("Only the doctor who added this location or an admin can change it")
+)
+
+type LocationBody struct {
+	Name       string   `json:"name" validate:"required,max=150"`
+	Address    string   `json:"address" validate:"required,max=255"`
+	City       string   `json:"city" validate:"required,max=100"`
+	PostalCode string   `json:"postalCode" validate:"max=20"`
+	Country    string   `json:"country" validate:"required,max=100"`
+	Phone      string   `json:"phone" validate:"max=30"`
+	Latitude   *float64 `json:"latitude" validate:"required,latitude"`
+	Longitude  *float64 `json:"longitude" validate:"required,longitude"`
+}
+
+func applyLocationBody(location *models.Location, body LocationBody) error {
+	// what a form sends when the map pin was never placed, distance search would be wrong
+	if *body.Latitude == 0 && *body.Longitude == 0 {
+		return errors.New("latitude and longitude must be the position of the location")
+	}
+
+	location.Name = body.Name
+	location.Address = body.Address
+	location.City = body.City
+	location.PostalCode = body.PostalCode
+	location.Country = body.Country
+	location.Phone = body.Phone
+	location.Latitude = *body.Latitude
+	location.Longitude = *body.Longitude
+	return nil
+}
+
+// one line postal address of the location
+func locationAddress(location *models.Location) string {
+	city := strings.TrimSpace(location.PostalCode + " " + location.City)
+	return strings.Join([]string{location.Name, location.Address, city, location.Country}, ", ")
+}
+
+// every location, optionally only the ones of a city, for doctors looking for their clinic
+func GetLocations(city string) ([]models.Location, error) {
+	var locations []models.Location
+
+	query := db.Db.Order("name")
+	if city = strings.TrimSpace(city); city != "" {
+		query = query.Where("LOWER(city) = LOWER(?)", city)
+	}
+
+	err := query.Find(&locations).Error
+	return locations, err
+}
+
+func GetDoctorLocations(userID uint) ([]models.Location, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var locations []models.Location
+	err = db.Db.Joins("JOIN doctor_locations ON doctor_locations.location_id = locations.id").
+		Where("doctor_locations.doctor_id = ?", doctorID).
+		Order("locations.name").
+		Find(&locations).Error
+
+	return locations, err
+}
+
+// fails with ErrLocationNotFound unless the location is one of the doctor's
+func ensureDoctorLocation(tx *gorm.DB, doctorID uint, locationID uint) error {
+	var count int64
+	err := tx.Table("doctor_locations").
+		Where("doctor_id = ? AND location_id = ?", doctorID, locationID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrLocationNotFound
+	}
+	return nil
+}
+
+// creates a new location and adds it to the doctor's locations
+func CreateDoctorLocation(userID uint, body LocationBody) (*models.Location, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	location := models.Location{CreatedByID: &doctorID}
+	if err := applyLocationBody(&location, body); err != nil {
+		return nil, err
+	}
+
+	err = db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&location).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.Doctor{ID: doctorID}).Association("Locations").Append(&location)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+// adds an existing location, shared with other doctors, to the doctor's locations
+func AttachLocation(userID uint, locationID uint) (*models.Location, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var location models.Location
+	if err := db.Db.First(&location, locationID).Error; err != nil {
+		return nil, ErrLocationNotFound
+	}
+
+	if err := db.Db.Model(&models.Doctor{ID: doctorID}).Association("Locations").Append(&location); err != nil {
+		return nil, err
+	}
+	return &location, nil
+}
+
+// only the doctor who added the location can change it, the change is seen by every doctor working there
+func UpdateDoctorLocation(userID uint, locationID uint, body LocationBody) (*models.Location, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ensureDoctorLocation(db.Db, doctorID, locationID); err != nil {
+		return nil, err
+	}
+
+	var location models.Location
+	if err := db.Db.First(&location, locationID).Error; err != nil {
+		return nil, ErrLocationNotFound
+	}
+	if location.CreatedByID == nil || *location.CreatedByID != doctorID {
+		return nil, ErrLocationReadOnly
+	}
+
+	return saveLocation(&location, body)
+}
+
+// admins can fix any location, e.g. one whose creator left
+func UpdateLocation(locationID uint, body LocationBody) (*models.Location, error) {
+	var location models.Location
+	if err := db.Db.First(&location, locationID).Error; err != nil {
+		return nil, ErrLocationNotFound
+	}
+
+	return saveLocation(&location, body)
+}
+
+func saveLocation(location *models.Location, body LocationBody) (*models.Location, error) {
+	if err := applyLocationBody(location, body); err != nil {
+		return nil, err
+	}
+	if err := db.Db.Save(location).Error; err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+// removes the location from the doctor's locations, the location itself is kept for the other doctors
+func DetachLocation(userID uint, locationID uint) error {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return err
+	}
+
+	return db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := ensureDoctorLocation(tx, doctorID, locationID); err != nil {
+			return err
+		}
+
+		var count int64
+		err := tx.Model(&models.DoctorSchedule{}).
+			Where("doctor_id = ? AND location_id = ?", doctorID, locationID).
+			Count(&count).Error
+		if err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("This location is still used by your working hours, change them first")
+		}
+
+		return tx.Model(&models.Doctor{ID: doctorID}).Association("Locations").Delete(&models.Location{ID: locationID})
+	})
+}
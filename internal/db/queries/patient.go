@@ -9,9 +9,14 @@ import (
 )
 
 type AppointmentRequest struct {
-	DoctorID        uint      `json:"doctorId"`
-	AppointmentDate time.Time `json:"appointmentDate"`
-	Reason          string    `json:"reason"`
+	DoctorID          uint      `json:"doctorId"`
+	AppointmentTypeID *uint     `json:"appointmentTypeId"`
+	AppointmentDate   time.Time `json:"appointmentDate"`
+	Reason            string    `json:"reason"`
+	// books for one of the patient's dependents instead of the patient
+	DependentID *uint `json:"dependentId"`
+	// optional, one of the doctor's locations working at that time
+	LocationID *uint `json:"locationId"`
 }
 
 type AppointmentUpdateRequest struct {
@@ -22,7 +27,7 @@ type AppointmentUpdateRequest struct {
 
 func GetPatientByUserID(userID uint) (*models.Patient, error) {
 	var patient models.Patient
-	if err := db.Db.Preload("User").Where("user_id = ?", userID).First(&patient).Error; err != nil {
+	if err := db.Db.Preload("User").Preload("InsuranceProvider").Where("user_id = ?", userID).First(&patient).Error; err != nil {
 		return nil, err
 	}
 	return &patient, nil
@@ -35,6 +40,12 @@ type UpdatePatientBody struct {
 	ChronicConditions *[]string `json:"chronicConditions" validate:"omitempty"`
 	Allergies         *[]string `json:"allergies" validate:"omitempty"`
 	Medications       *[]string `json:"medications" validate:"omitempty"`
+
+	// 0 removes the insurance
+	InsuranceProviderID *uint      `json:"insuranceProviderId"`
+	PolicyNumber        *string    `json:"policyNumber" validate:"omitempty,max=50"`
+	PolicyHolder        *string    `json:"policyHolder" validate:"omitempty,max=150"`
+	PolicyExpiresAt     *time.Time `json:"policyExpiresAt"`
 }
 
 func UpdatePatient(userID uint, body UpdatePatientBody) (*models.Patient, error) {
@@ -63,9 +74,31 @@ func UpdatePatient(userID uint, body UpdatePatientBody) (*models.Patient, error)
 		patient.Medications = *body.Medications
 	}
 
+	if body.InsuranceProviderID != nil {
+		patient.InsuranceProviderID = nil
+		if *body.InsuranceProviderID != 0 {
+			if _, err := findActiveProviders(db.Db, []uint{*body.InsuranceProviderID}); err != nil {
+				return nil, ErrInsuranceProviderNotFound
+			}
+			patient.InsuranceProviderID = body.InsuranceProviderID
+		}
+	}
+	if body.PolicyNumber != nil {
+		patient.PolicyNumber = *body.PolicyNumber
+	}
+	if body.PolicyHolder != nil {
+		patient.PolicyHolder = *body.PolicyHolder
+	}
+	if body.PolicyExpiresAt != nil {
+		patient.PolicyExpiresAt = body.PolicyExpiresAt
+	}
+
 	if err := db.Db.Save(&patient).Error; err != nil {
 		return nil, err
 	}
 
+	if err := db.Db.Preload("InsuranceProvider").First(&patient, patient.ID).Error; err != nil {
+		return nil, err
+	}
 	return &patient, nil
 }
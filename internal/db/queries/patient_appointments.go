@@ -5,86 +5,147 @@ import (
 
 	"github.com/YahiaJouini/careflow/internal/db"
 	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
 )
 
+var ErrAppointmentNotFound = errors.New("Appointment not found")
+
 func CreateAppointment(patientID uint, req AppointmentRequest) (*models.Appointment, error) {
-	var doctor models.Doctor
+	var appointment *models.Appointment
 
-	if err := db.Db.First(&doctor, req.DoctorID).Error; err != nil {
-		return nil, errors.New("Doctor not found")
-	}
-	if !doctor.IsAvailable {
-		return nil, errors.New("Doctor is currently unavailable")
-	}
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		doctor, err := lockDoctor(tx, req.DoctorID)
+		if err != nil {
+			return err
+		}
+		if !doctor.IsAvailable {
+			return errors.New("Doctor is currently unavailable")
+		}
+		if err := ensureCanBook(tx, patientID); err != nil {
+			return err
+		}
+		if err := resolveDependent(tx, patientID, req.DependentID); err != nil {
+			return err
+		}
 
-	appointment := models.Appointment{
-		PatientID:       patientID,
-		DoctorID:        req.DoctorID,
-		AppointmentDate: req.AppointmentDate,
-		Reason:          req.Reason,
-		Status:          models.StatusPending,
-	}
+		appointmentType, err := resolveAppointmentType(tx, doctor.ID, req.AppointmentTypeID)
+		if err != nil {
+			return err
+		}
 
-	if err := db.Db.Create(&appointment).Error; err != nil {
-		return nil, err
+		appointment, err = bookAppointment(tx, booking{
+			PatientID:   patientID,
+			DependentID: req.DependentID,
+			DoctorID:    doctor.ID,
+			Date:        req.AppointmentDate,
+			Reason:      req.Reason,
+			Type:        appointmentType,
+			LocationID:  req.LocationID,
+		})
+		if err != nil {
+			return err
+		}
+
+		// booking goes through, the patient decides whether to keep it
+		appointment.Warnings, err = coverageWarnings(tx, patientID, req.DependentID, doctor.ID, appointment.AppointmentDate)
+		return err
+	})
+	if err != nil {
+		return nil, bookingError(err)
 	}
-	return &appointment, nil
+
+	localizeAppointment(appointment, userLocation(patientID))
+	return appointment, nil
 }
 
 func GetPatientAppointments(patientID uint) ([]models.Appointment, error) {
 	var appointments []models.Appointment
 
-	err := db.Db.Preload("Doctor").Preload("Doctor.User").
+	err := db.Db.Preload("Doctor").Preload("Doctor.User").Preload("Dependent", unscoped).Preload("AppointmentType").Preload("Location").
 		Where("patient_id = ? AND status != ?", patientID, models.StatusCompleted).
 		Order("appointment_date desc").
 		Find(&appointments).Error
 
+	localizeAppointments(appointments, userLocation(patientID))
 	return appointments, err
 }
 
 func GetMedicalHistory(patientID uint) ([]models.Appointment, error) {
 	var appointments []models.Appointment
 
-	err := db.Db.Preload("Doctor").Preload("Doctor.User").
+	err := db.Db.Preload("Doctor").Preload("Doctor.User").Preload("Dependent", unscoped).Preload("AppointmentType").Preload("Location").
 		Where("patient_id = ? AND status = ?", patientID, models.StatusCompleted).
 		Order("appointment_date desc").
 		Find(&appointments).Error
 
+	localizeAppointments(appointments, userLocation(patientID))
 	return appointments, err
 }
 
-func UpdateAppointment(appointmentID uint, patientID uint, req AppointmentUpdateRequest) (*models.Appointment, error) {
+func UpdateAppointment(appointmentID uint, patientID uint, req AppointmentUpdateRequest, scope string) (*models.Appointment, error) {
 	var appointment models.Appointment
 
-	if err := db.Db.Where("id = ? AND patient_id = ?", appointmentID, patientID).First(&appointment).Error; err != nil {
-		return nil, errors.New("Appointment not found")
-	}
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND patient_id = ?", appointmentID, patientID).First(&appointment).Error; err != nil {
+			return ErrAppointmentNotFound
+		}
 
-	if !appointment.AppointmentDate.Equal(req.AppointmentDate) {
-		if appointment.Status == models.StatusConfirmed {
-			appointment.Status = models.StatusPending
+		if !isActiveStatus(appointment.Status) && appointment.Status != models.StatusNeedsReschedule {
+			return errors.New("Only upcoming, ongoing or to be rescheduled appointments can be changed")
+		}
+
+		appointment.Reason = req.Reason
+		if appointment.AppointmentDate.Equal(req.AppointmentDate) {
+			return tx.Save(&appointment).Error
+		}
+		if !isMovableStatus(appointment.Status) {
+			return ErrNotMovable
 		}
-	}
 
-	appointment.AppointmentDate = req.AppointmentDate
-	appointment.Reason = req.Reason
+		occurrences, err := selectOccurrences(tx, &appointment, scope)
+		if err != nil {
+			return err
+		}
+		occurrences[0].Reason = req.Reason
 
-	if err := db.Db.Save(&appointment).Error; err != nil {
-		return nil, err
+		if err := moveOccurrences(tx, occurrences, req.AppointmentDate, Actor{UserID: patientID, Role: models.ActorPatient}); err != nil {
+			return err
+		}
+		appointment = occurrences[0]
+		return nil
+	})
+	if err != nil {
+		return nil, bookingError(err)
 	}
 
+	localizeAppointment(&appointment, userLocation(patientID))
 	return &appointment, nil
 }
 
-func CancelAppointment(appointmentID uint, patientID uint) error {
-	var appointment models.Appointment
+// ids of the occurrences that were kept because they are inside the notice window
+func CancelAppointment(appointmentID uint, patientID uint, req CancelAppointmentRequest, scope string) ([]uint, error) {
+	var offers []models.WaitlistEntry
+	var tooLate []uint
 
-	if err := db.Db.Where("id = ? AND patient_id = ?", appointmentID, patientID).First(&appointment).Error; err != nil {
-		return errors.New("Appointment not found")
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		var appointment models.Appointment
+		if err := tx.Where("id = ? AND patient_id = ?", appointmentID, patientID).First(&appointment).Error; err != nil {
+			return ErrAppointmentNotFound
+		}
+
+		occurrences, err := selectOccurrences(tx, &appointment, scope)
+		if err != nil {
+			return err
+		}
+		offers, tooLate, err = cancelOccurrences(tx, occurrences, Actor{UserID: patientID, Role: models.ActorPatient}, req)
+		return err
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	appointment.Status = models.StatusCancelled
-	return db.Db.Save(&appointment).Error
+	notifyWaitlistOffers(offers)
+	return tooLate, nil
 }
 
 func DeleteAppointment(appointmentID uint, patientID uint) error {
@@ -1,22 +1,242 @@
 package queries
 
 import (
+	"errors"
+	"math"
+	"sort"
+	"time"
+
 	"github.com/YahiaJouini/careflow/internal/db"
 	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
 )
 
-func GetPublicDoctors(specialtyID uint) ([]models.Doctor, error) {
-	var doctors []models.Doctor
+// mean radius of the earth
+const earthRadiusKm = 6371
+
+// km covered by one degree of latitude
+const kmPerLatitudeDegree = math.Pi * earthRadiusKm / 180
+
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+type PublicDoctorFilter struct {
+	SpecialtyID uint
+	// when set only doctors with a location within RadiusKm are kept, nearest first
+	Near     *GeoPoint
+	RadiusKm float64
+	// best rated first instead of nearest first
+	ByRating bool
+
+	// doctors speaking at least one of these languages
+	Languages     []string
+	MinExperience int
+	// doctors accepting this insurance provider
+	InsuranceProviderID uint
+}
+
+// filters on the professional profile, shared by the listing and the search
+func filterDoctorProfiles(query *gorm.DB, filter PublicDoctorFilter) *gorm.DB {
+	if len(filter.Languages) > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM jsonb_array_elements_text(doctors.languages) AS spoken WHERE spoken IN ?)", filter.Languages)
+	}
+	if filter.MinExperience > 0 {
+		query = query.Where("doctors.years_of_experience >= ?", filter.MinExperience)
+	}
+	if filter.InsuranceProviderID > 0 {
+		query = query.Where("EXISTS (SELECT 1 FROM doctor_insurance_providers WHERE doctor_insurance_providers.doctor_id = doctors.id AND doctor_insurance_providers.insurance_provider_id = ?)", filter.InsuranceProviderID)
+	}
+	return query
+}
+
+// great circle distance in km from the point (earth radius, latitude, latitude, longitude)
+// to a location (haversine formula), rounding errors can push the sine slightly above 1
+const haversineSQL = "2 * ? * ASIN(LEAST(1, SQRT(" +
+	"POWER(SIN(RADIANS(locations.latitude - ?) / 2), 2) + " +
+	"COS(RADIANS(?)) * COS(RADIANS(locations.latitude)) * POWER(SIN(RADIANS(locations.longitude - ?) / 2), 2))))"
+
+// a doctor practicing near the searched point
+type doctorDistance struct {
+	DoctorID uint
+	// to the nearest of the doctor's locations, rounded to 100 m
+	DistanceKm float64
+}
+
+// every doctor practicing within radiusKm of the point, nearest first. The latitude band of
+// the circle narrows the locations before the exact distance is computed
+func nearbyDoctors(point GeoPoint, radiusKm float64) ([]doctorDistance, error) {
+	band := radiusKm / kmPerLatitudeDegree
+	distance := []interface{}{earthRadiusKm, point.Latitude, point.Latitude, point.Longitude}
+
+	var nearby []doctorDistance
+	err := db.Db.Table("doctor_locations").
+		Select("doctor_locations.doctor_id, ROUND(MIN("+haversineSQL+")::numeric, 1) AS distance_km", distance...).
+		Joins("JOIN locations ON locations.id = doctor_locations.location_id").
+		Where("locations.latitude BETWEEN ? AND ?", point.Latitude-band, point.Latitude+band).
+		Where(haversineSQL+" <= ?", append(distance, radiusKm)...).
+		Group("doctor_locations.doctor_id").
+		Order("distance_km, doctor_locations.doctor_id").
+		Scan(&nearby).Error
+	return nearby, err
+}
+
+// ids of the nearby doctors in the same order and their distance
+func nearbyIndex(nearby []doctorDistance) ([]uint, map[uint]float64) {
+	ids := make([]uint, len(nearby))
+	distances := make(map[uint]float64, len(nearby))
+	for i, doctor := range nearby {
+		ids[i] = doctor.DoctorID
+		distances[doctor.DoctorID] = doctor.DistanceKm
+	}
+	return ids, distances
+}
+
+func GetPublicDoctors(filter PublicDoctorFilter) ([]PublicDoctorSummary, error) {
+	doctors := []models.Doctor{}
+	summaries := []PublicDoctorSummary{}
 
 	query := db.Db.
 		Preload("User").
 		Preload("Specialty").
+		Preload("Locations").
+		Preload("AcceptedInsurances").
 		Where("is_verified = ?", true)
 
-	if specialtyID > 0 {
-		query = query.Where("specialty_id = ?", specialtyID)
+	if filter.SpecialtyID > 0 {
+		query = query.Where("specialty_id = ?", filter.SpecialtyID)
+	}
+	query = filterDoctorProfiles(query, filter)
+
+	var distances map[uint]float64
+	if filter.Near != nil {
+		nearby, err := nearbyDoctors(*filter.Near, filter.RadiusKm)
+		if err != nil {
+			return nil, err
+		}
+		if len(nearby) == 0 {
+			return summaries, nil
+		}
+
+		var ids []uint
+		ids, distances = nearbyIndex(nearby)
+		query = query.Where("id IN ?", ids)
+	}
+
+	if filter.ByRating {
+		query = query.Order("average_rating DESC, review_count DESC")
+	}
+	if err := query.Find(&doctors).Error; err != nil {
+		return nil, err
+	}
+
+	for i := range doctors {
+		summary := newPublicDoctorSummary(&doctors[i])
+		if distance, ok := distances[doctors[i].ID]; ok {
+			summary.DistanceKm = &distance
+		}
+		summaries = append(summaries, summary)
+	}
+	if distances != nil && !filter.ByRating {
+		sort.SliceStable(summaries, func(i, j int) bool { return *summaries[i].DistanceKm < *summaries[j].DistanceKm })
+	}
+	return summaries, nil
+}
+
+// how far ahead the next open slots of a public profile are looked for
+const profileSlotsLookahead = 31 * 24 * time.Hour
+
+type PublicDoctorStats struct {
+	CompletedVisits int64     `json:"completedVisits"`
+	PatientsSeen    int64     `json:"patientsSeen"`
+	MemberSince     time.Time `json:"memberSince"`
+}
+
+// what anyone can see of a doctor, without the account details of the user behind it
+type PublicDoctorProfile struct {
+	ID        uint   `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Image     string `json:"image"`
+
+	Specialty       models.Specialty  `json:"specialty"`
+	Bio             string            `json:"bio"`
+	ConsultationFee float64           `json:"consultationFee"`
+	AverageRating   float64           `json:"averageRating"`
+	ReviewCount     int               `json:"reviewCount"`
+	IsAvailable     bool              `json:"isAvailable"`
+	TimeZone        string            `json:"timeZone"`
+	Locations       []models.Location `json:"locations"`
+
+	Languages            []string        `json:"languages"`
+	Education            []models.Degree `json:"education"`
+	YearsOfExperience    int             `json:"yearsOfExperience"`
+	HospitalAffiliations []string        `json:"hospitalAffiliations"`
+
+	AcceptedInsurances []models.InsuranceProvider `json:"acceptedInsurances"`
+
+	Stats     PublicDoctorStats `json:"stats"`
+	NextSlots []Slot            `json:"nextSlots"`
+}
+
+// profile of a verified doctor with its next free slots, at most slotCount of them
+func GetPublicDoctorProfile(doctorID uint, slotCount int) (*PublicDoctorProfile, error) {
+	var doctor models.Doctor
+	err := db.Db.Preload("User").Preload("Specialty").Preload("Locations").Preload("AcceptedInsurances").
+		Where("id = ? AND is_verified = ?", doctorID, true).
+		First(&doctor).Error
+	if err != nil {
+		return nil, errors.New("Doctor not found")
+	}
+
+	profile := PublicDoctorProfile{
+		ID:              doctor.ID,
+		FirstName:       doctor.User.FirstName,
+		LastName:        doctor.User.LastName,
+		Image:           doctor.User.Image,
+		Specialty:       doctor.Specialty,
+		Bio:             doctor.Bio,
+		ConsultationFee: doctor.ConsultationFee,
+		AverageRating:   doctor.AverageRating,
+		ReviewCount:     doctor.ReviewCount,
+		IsAvailable:     doctor.IsAvailable,
+		TimeZone:        doctor.TimeZone,
+		Locations:       doctor.Locations,
+
+		Languages:            doctor.Languages,
+		Education:            doctor.Education,
+		YearsOfExperience:    doctor.YearsOfExperience,
+		HospitalAffiliations: doctor.HospitalAffiliations,
+		AcceptedInsurances:   doctor.AcceptedInsurances,
+
+		Stats: PublicDoctorStats{MemberSince: doctor.CreatedAt},
+	}
+
+	err = db.Db.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND status = ?", doctor.ID, models.StatusCompleted).
+		Count(&profile.Stats.CompletedVisits).Error
+	if err != nil {
+		return nil, err
+	}
+	// a dependent is a patient of their own
+	err = db.Db.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND status = ?", doctor.ID, models.StatusCompleted).
+		Select("COUNT(DISTINCT (patient_id, COALESCE(dependent_id, 0)))").
+		Scan(&profile.Stats.PatientsSeen).Error
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	slots, err := freeSlots(&doctor, now, now.Add(profileSlotsLookahead), 0, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(slots) > slotCount {
+		slots = slots[:slotCount]
 	}
+	profile.NextSlots = slots
 
-	err := query.Find(&doctors).Error
-	return doctors, err
+	return &profile, nil
 }
@@ -0,0 +1,27 @@
+package queries
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNearbyIndex(t *testing.T) {
+	nearby := []doctorDistance{
+		{DoctorID: 4, DistanceKm: 1.2},
+		{DoctorID: 1, DistanceKm: 6.3},
+		{DoctorID: 9, DistanceKm: 6.3},
+	}
+
+	ids, distances := nearbyIndex(nearby)
+	if want := []uint{4, 1, 9}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("ids = %v, want the nearest first %v", ids, want)
+	}
+	if want := map[uint]float64{4: 1.2, 1: 6.3, 9: 6.3}; !reflect.DeepEqual(distances, want) {
+		t.Errorf("distances = %v, want %v", distances, want)
+	}
+
+	ids, distances = nearbyIndex(nil)
+	if len(ids) != 0 || len(distances) != 0 {
+		t.Errorf("nearbyIndex(nil) = %v, %v", ids, distances)
+	}
+}
@@ -0,0 +1,90 @@
+package queries
+
+import (
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+)
+
+type QueueEntry struct {
+	// place in the waiting room, 0 for patients already with the doctor
+	Position    int                `json:"position"`
+	Appointment models.Appointment `json:"appointment"`
+	// since check-in, or until the doctor started for patients already in
+	WaitMinutes int `json:"waitMinutes"`
+}
+
+type DoctorQueue struct {
+	InProgress []QueueEntry `json:"inProgress"`
+	Waiting    []QueueEntry `json:"waiting"`
+	// of the patients seen today
+	AverageWaitMinutes int `json:"averageWaitMinutes"`
+}
+
+func CheckInAppointment(appointmentID uint, patientID uint) (*models.Appointment, error) {
+	var appt models.Appointment
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND patient_id = ?", appointmentID, patientID).First(&appt).Error; err != nil {
+			return ErrAppointmentNotFound
+		}
+		return transitionAppointment(tx, &appt, models.StatusCheckedIn, Actor{UserID: patientID, Role: models.ActorPatient}, "")
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	localizeAppointment(&appt, userLocation(patientID))
+	return &appt, nil
+}
+
+// today's checked-in patients of the doctor. Patients wait in the order of their booked time,
+// so arriving early doesn't pass anyone booked before
+func GetDoctorQueue(userID uint) (*DoctorQueue, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	dayStart := startOfDay(now, DoctorLocation(doctorID))
+
+	var appointments []models.Appointment
+	err = db.Db.Preload("Patient").Preload("Dependent", unscoped).Preload("AppointmentType").Preload("Location").
+		Where("doctor_id = ? AND status IN ? AND appointment_date >= ? AND appointment_date < ?",
+			doctorID, []string{models.StatusCheckedIn, models.StatusInProgress}, dayStart, dayStart.AddDate(0, 0, 1)).
+		Order("appointment_date, checked_in_at").
+		Find(&appointments).Error
+	if err != nil {
+		return nil, err
+	}
+	localizeAppointments(appointments, userLocation(userID))
+
+	queue := &DoctorQueue{InProgress: []QueueEntry{}, Waiting: []QueueEntry{}}
+	for _, appt := range appointments {
+		switch appt.Status {
+		case models.StatusInProgress:
+			queue.InProgress = append(queue.InProgress, QueueEntry{Appointment: appt, WaitMinutes: waitedMinutes(appt.CheckedInAt, *appt.StartedAt)})
+		case models.StatusCheckedIn:
+			queue.Waiting = append(queue.Waiting, QueueEntry{Position: len(queue.Waiting) + 1, Appointment: appt, WaitMinutes: waitedMinutes(appt.CheckedInAt, now)})
+		}
+	}
+
+	// patients already taken in today, including the ones done since
+	var average float64
+	db.Db.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND started_at >= ? AND checked_in_at IS NOT NULL", doctorID, dayStart).
+		Select("COALESCE(AVG(EXTRACT(EPOCH FROM started_at - checked_in_at)) / 60, 0)").
+		Scan(&average)
+	queue.AverageWaitMinutes = int(average)
+
+	return queue, nil
+}
+
+func waitedMinutes(since *time.Time, until time.Time) int {
+	if since == nil || until.Before(*since) {
+		return 0
+	}
+	return int(until.Sub(*since).Minutes())
+}
@@ -0,0 +1,119 @@
+package queries
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/pkg/mails"
+	"gorm.io/gorm/clause"
+)
+
+// time a claimed reminder is left to its sender before another run may send it
+const reminderClaimLease = 10 * time.Minute
+
+// appointments starting in (From, To] get the reminder sent OffsetMinutes before them
+type reminderWindow struct {
+	OffsetMinutes int
+	From          time.Time
+	To            time.Time
+}
+
+// one window per offset, offsets sorted from the longest to the shortest. A window ends where
+// the next shorter one starts, so an appointment booked at the last minute gets a single email
+func reminderWindows(offsets []time.Duration, now time.Time) []reminderWindow {
+	windows := make([]reminderWindow, len(offsets))
+	for i, offset := range offsets {
+		var next time.Duration
+		if i+1 < len(offsets) {
+			next = offsets[i+1]
+		}
+		windows[i] = reminderWindow{OffsetMinutes: int(offset.Minutes()), From: now.Add(next), To: now.Add(offset)}
+	}
+	return windows
+}
+
+// emails the patients of confirmed appointments that entered a reminder window, offsets
+// must be sorted from the longest to the shortest
+func SendAppointmentReminders(offsets []time.Duration) error {
+	now := time.Now()
+
+	for _, window := range reminderWindows(offsets, now) {
+		var appointments []models.Appointment
+		err := db.Db.Preload("Patient").Preload("Dependent", unscoped).Preload("Doctor.User").Preload("AppointmentType").Preload("Location").
+			Where("status = ? AND appointment_date > ? AND appointment_date <= ?", models.StatusConfirmed, window.From, window.To).
+			Where(`NOT EXISTS (SELECT 1 FROM appointment_reminders WHERE appointment_reminders.appointment_id = appointments.id
+				AND appointment_reminders.offset_minutes = ? AND appointment_reminders.appointment_date = appointments.appointment_date
+				AND (appointment_reminders.sent_at IS NOT NULL OR appointment_reminders.claimed_at > ?))`, window.OffsetMinutes, now.Add(-reminderClaimLease)).
+			Find(&appointments).Error
+		if err != nil {
+			return err
+		}
+
+		for _, appt := range appointments {
+			if err := sendReminder(appt, window.OffsetMinutes); err != nil {
+				log.Println("failed to send reminder for appointment", appt.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func sendReminder(appt models.Appointment, offsetMinutes int) error {
+	now := time.Now()
+	reminder := models.AppointmentReminder{
+		AppointmentID:   appt.ID,
+		OffsetMinutes:   offsetMinutes,
+		AppointmentDate: appt.AppointmentDate,
+		ClaimedAt:       now,
+	}
+	// another instance may have claimed it between the query and now, an unsent claim whose
+	// lease is over is taken back
+	result := db.Db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "appointment_id"}, {Name: "offset_minutes"}, {Name: "appointment_date"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{"claimed_at": now}),
+		Where: clause.Where{Exprs: []clause.Expression{clause.Expr{
+			SQL:  "appointment_reminders.sent_at IS NULL AND appointment_reminders.claimed_at <= ?",
+			Vars: []interface{}{now.Add(-reminderClaimLease)},
+		}}},
+	}).Create(&reminder)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	doctor := appt.Doctor.User.FirstName + " " + appt.Doctor.User.LastName
+	heading := "Your appointment is coming up"
+	first := fmt.Sprintf("Your appointment with Dr. %s is on %s.", doctor, formatLocal(appt.AppointmentDate, appt.Patient.TimeZone, "Monday 02 January 2006 at 15:04"))
+	if appt.Dependent != nil {
+		first = fmt.Sprintf("%s's appointment with Dr. %s is on %s.", appt.Dependent.FirstName, doctor, formatLocal(appt.AppointmentDate, appt.Patient.TimeZone, "Monday 02 January 2006 at 15:04"))
+	}
+
+	lines := []string{first}
+	if appt.Location != nil && (appt.AppointmentType == nil || appt.AppointmentType.Mode != models.ModeVideo) {
+		lines = append(lines, "Location: "+locationAddress(appt.Location))
+	}
+	if appt.AppointmentType != nil {
+		lines = append(lines, "Visit: "+appt.AppointmentType.Name)
+		if appt.AppointmentType.Mode == models.ModeVideo {
+			lines = append(lines, "This is a video consultation, you will join it from CareFlow.")
+		}
+	}
+	lines = append(lines, "If you can no longer make it, cancel it in CareFlow so the time can go to another patient.")
+
+	sent := mails.SendNotification(appt.Patient.Email, mails.Notification{
+		Subject: "Reminder: appointment with Dr. " + appt.Doctor.User.LastName,
+		Heading: heading,
+		Lines:   lines,
+	})
+	if sent.Err != nil {
+		// give the claim back so the next run tries again, else it is retried once the lease is over
+		if err := db.Db.Delete(&reminder).Error; err != nil {
+			log.Println("failed to release reminder claim", reminder.ID, err)
+		}
+		return sent.Err
+	}
+
+	return db.Db.Model(&reminder).Update("sent_at", time.Now()).Error
+}
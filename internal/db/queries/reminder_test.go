@@ -0,0 +1,50 @@
+package queries
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReminderWindows(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+
+	// which reminder an appointment starting after the given delay gets, 0 for none
+	reminderFor := func(windows []reminderWindow, delay time.Duration) int {
+		start := now.Add(delay)
+		for _, window := range windows {
+			if start.After(window.From) && !start.After(window.To) {
+				return window.OffsetMinutes
+			}
+		}
+		return 0
+	}
+
+	tests := []struct {
+		name    string
+		offsets []time.Duration
+		delay   time.Duration
+		want    int
+	}{
+		{"a day ahead gets the day before reminder", []time.Duration{24 * time.Hour, time.Hour}, 24 * time.Hour, 1440},
+		{"half a day ahead gets the day before reminder", []time.Duration{24 * time.Hour, time.Hour}, 12 * time.Hour, 1440},
+		{"in an hour gets only the last reminder", []time.Duration{24 * time.Hour, time.Hour}, time.Hour, 60},
+		{"in ten minutes still gets the last reminder", []time.Duration{24 * time.Hour, time.Hour}, 10 * time.Minute, 60},
+		{"too far ahead", []time.Duration{24 * time.Hour, time.Hour}, 25 * time.Hour, 0},
+		{"already started", []time.Duration{24 * time.Hour, time.Hour}, 0, 0},
+		{"single offset covers everything up to it", []time.Duration{2 * time.Hour}, 30 * time.Minute, 120},
+		{"three offsets", []time.Duration{48 * time.Hour, 24 * time.Hour, time.Hour}, 30 * time.Hour, 2880},
+		{"no offsets", nil, time.Hour, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows := reminderWindows(tt.offsets, now)
+			if len(windows) != len(tt.offsets) {
+				t.Fatalf("%d windows for %d offsets", len(windows), len(tt.offsets))
+			}
+			if got := reminderFor(windows, tt.delay); got != tt.want {
+				t.Errorf("appointment in %v gets the %d minutes reminder, want %d", tt.delay, got, tt.want)
+			}
+		})
+	}
+}
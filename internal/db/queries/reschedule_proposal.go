@@ -0,0 +1,338 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/pkg/mails"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrNoOpenProposal = errors.New("There is no open reschedule proposal for this appointment")
+
+type RescheduleProposalRequest struct {
+	Options []time.Time `json:"options" validate:"required,min=1,max=5"`
+	Note    string      `json:"note"`
+}
+
+type AcceptProposalRequest struct {
+	Option time.Time `json:"option" validate:"required"`
+}
+
+type DeclineProposalRequest struct {
+	Reason string `json:"reason"`
+}
+
+// puts the appointment in reschedule_proposed after checking that every option is bookable,
+// the options are not held and are checked again when the patient accepts one. The slots of
+// excludeIDs (the appointment itself and the rest of its series) don't count as taken
+func createProposal(tx *gorm.DB, appt *models.Appointment, options []time.Time, actor Actor, note string, excludeIDs ...uint) (*models.RescheduleProposal, error) {
+	duration := time.Duration(appt.DurationMinutes) * time.Minute
+	for i, option := range options {
+		for _, other := range options[:i] {
+			if other.Equal(option) {
+				return nil, errors.New("Proposed times must be different")
+			}
+		}
+
+		slot, err := validateAppointmentTime(tx, appt.DoctorID, option, duration)
+		if err != nil {
+			return nil, fmt.Errorf("Option %s: %w", option.Format("2006-01-02 15:04"), err)
+		}
+		if err := ensureNotOnTimeOff(tx, appt.DoctorID, *slot); err != nil {
+			return nil, fmt.Errorf("Option %s: %w", option.Format("2006-01-02 15:04"), err)
+		}
+		if err := ensureSlotFree(tx, appt.DoctorID, *slot, append([]uint{appt.ID}, excludeIDs...)...); err != nil {
+			return nil, fmt.Errorf("Option %s: %w", option.Format("2006-01-02 15:04"), err)
+		}
+	}
+
+	policy, err := getBookingPolicy(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	proposal := models.RescheduleProposal{
+		AppointmentID:  appt.ID,
+		ProposedByID:   actor.UserID,
+		Options:        options,
+		Note:           note,
+		Status:         models.ProposalOpen,
+		PreviousStatus: appt.Status,
+		ExpiresAt:      time.Now().Add(time.Duration(policy.RescheduleProposalHours) * time.Hour),
+	}
+
+	if err := transitionAppointment(tx, appt, models.StatusRescheduleProposed, actor, note); err != nil {
+		return nil, err
+	}
+	if err := tx.Create(&proposal).Error; err != nil {
+		return nil, err
+	}
+	return &proposal, nil
+}
+
+// proposes new times for the appointment alone, or one shifted time for each of the
+// following occurrences of its series
+func proposeOccurrences(tx *gorm.DB, occurrences []models.Appointment, newDate time.Time, actor Actor, note string) ([]uint, error) {
+	// shifting a series by its own interval lands each occurrence on the next one's slot
+	ids := occurrenceIDs(occurrences)
+
+	var proposalIDs []uint
+	for i, target := range shiftedDates(occurrences, newDate, doctorLocation(tx, occurrences[0].DoctorID)) {
+		proposal, err := createProposal(tx, &occurrences[i], []time.Time{target}, actor, note, ids...)
+		if err != nil {
+			return nil, err
+		}
+		proposalIDs = append(proposalIDs, proposal.ID)
+	}
+	return proposalIDs, nil
+}
+
+func ProposeReschedule(userID uint, appointmentID uint, req RescheduleProposalRequest) (*models.RescheduleProposal, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var proposal *models.RescheduleProposal
+	err = db.Db.Transaction(func(tx *gorm.DB) error {
+		if _, err := lockDoctor(tx, doctorID); err != nil {
+			return err
+		}
+
+		var appt models.Appointment
+		if err := tx.Where("id = ? AND doctor_id = ?", appointmentID, doctorID).First(&appt).Error; err != nil {
+			return ErrAppointmentNotFound
+		}
+
+		proposal, err = createProposal(tx, &appt, req.Options, Actor{UserID: userID, Role: models.ActorDoctor}, req.Note)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	notifyRescheduleProposals([]uint{proposal.ID})
+	return proposal, nil
+}
+
+// fails with ErrAppointmentNotFound unless the actor is part of the appointment (admins see everything)
+func ensureAppointmentAccess(appointmentID uint, actor Actor) error {
+	query := db.Db.Model(&models.Appointment{}).Where("id = ?", appointmentID)
+
+	switch actor.Role {
+	case models.ActorPatient:
+		query = query.Where("patient_id = ?", actor.UserID)
+	case models.ActorDoctor:
+		doctorID, err := getDoctorID(actor.UserID)
+		if err != nil {
+			return err
+		}
+		query = query.Where("doctor_id = ?", doctorID)
+	}
+
+	var count int64
+	if err := query.Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrAppointmentNotFound
+	}
+	return nil
+}
+
+// every proposal made for the appointment, newest first
+func GetRescheduleProposals(appointmentID uint, actor Actor) ([]models.RescheduleProposal, error) {
+	if err := ensureAppointmentAccess(appointmentID, actor); err != nil {
+		return nil, err
+	}
+
+	var proposals []models.RescheduleProposal
+	err := db.Db.Where("appointment_id = ?", appointmentID).
+		Order("created_at desc, id desc").
+		Find(&proposals).Error
+
+	return proposals, err
+}
+
+func findOpenProposal(tx *gorm.DB, appointmentID uint) (*models.RescheduleProposal, error) {
+	var proposal models.RescheduleProposal
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("appointment_id = ? AND status = ?", appointmentID, models.ProposalOpen).
+		First(&proposal).Error
+	if err != nil {
+		return nil, ErrNoOpenProposal
+	}
+	if !proposal.ExpiresAt.After(time.Now()) {
+		return nil, errors.New("This reschedule proposal has expired")
+	}
+	return &proposal, nil
+}
+
+// closes the proposal with the patient's answer
+func answerProposal(tx *gorm.DB, proposal *models.RescheduleProposal, status string, chosen *time.Time) error {
+	now := time.Now()
+	proposal.Status = status
+	proposal.ChosenTime = chosen
+	proposal.RespondedAt = &now
+	return tx.Save(proposal).Error
+}
+
+// moves the appointment to the chosen option and confirms it
+func AcceptRescheduleProposal(appointmentID uint, patientID uint, req AcceptProposalRequest) (*models.Appointment, error) {
+	var appt models.Appointment
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("id = ? AND patient_id = ?", appointmentID, patientID).First(&appt).Error; err != nil {
+			return ErrAppointmentNotFound
+		}
+
+		proposal, err := findOpenProposal(tx, appt.ID)
+		if err != nil {
+			return err
+		}
+
+		proposed := false
+		for _, option := range proposal.Options {
+			if option.Equal(req.Option) {
+				proposed = true
+				break
+			}
+		}
+		if !proposed {
+			return errors.New("This time was not proposed by the doctor")
+		}
+
+		duration := time.Duration(appt.DurationMinutes) * time.Minute
+		_, slot, err := reserveSlot(tx, appt.DoctorID, req.Option, duration, appt.ID)
+		if err != nil {
+			return err
+		}
+
+		if err := answerProposal(tx, proposal, models.ProposalAccepted, &slot.StartsAt); err != nil {
+			return err
+		}
+
+		appt.AppointmentDate = slot.StartsAt
+		appt.EndsAt = slot.EndsAt
+		appt.LocationID = slot.LocationID
+		return transitionAppointment(tx, &appt, models.StatusConfirmed, Actor{UserID: patientID, Role: models.ActorPatient}, "Accepted the proposed time")
+	})
+	if err != nil {
+		return nil, bookingError(err)
+	}
+
+	localizeAppointment(&appt, userLocation(patientID))
+	return &appt, nil
+}
+
+// declining a proposal cancels the appointment
+func DeclineRescheduleProposal(appointmentID uint, patientID uint, reason string) error {
+	var offers []models.WaitlistEntry
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		var appt models.Appointment
+		if err := tx.Where("id = ? AND patient_id = ?", appointmentID, patientID).First(&appt).Error; err != nil {
+			return ErrAppointmentNotFound
+		}
+
+		proposal, err := findOpenProposal(tx, appt.ID)
+		if err != nil {
+			return err
+		}
+		if err := answerProposal(tx, proposal, models.ProposalDeclined, nil); err != nil {
+			return err
+		}
+
+		cancellation := CancelAppointmentRequest{ReasonCode: models.CancelReasonDeclinedReschedule, Reason: reason}
+		offers, _, err = cancelOccurrences(tx, []models.Appointment{appt}, Actor{UserID: patientID, Role: models.ActorPatient}, cancellation)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	notifyWaitlistOffers(offers)
+	return nil
+}
+
+// closes unanswered proposals, their appointment goes back to the status it had before
+func ExpireRescheduleProposals() error {
+	return db.Db.Transaction(func(tx *gorm.DB) error {
+		var expired []models.RescheduleProposal
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Preload("Appointment").
+			Where("status = ? AND expires_at <= ?", models.ProposalOpen, time.Now()).
+			Find(&expired).Error
+		if err != nil {
+			return err
+		}
+
+		for _, proposal := range expired {
+			proposal.Status = models.ProposalExpired
+			if err := tx.Omit("Appointment").Save(&proposal).Error; err != nil {
+				return err
+			}
+
+			appt := proposal.Appointment
+			if appt.Status != models.StatusRescheduleProposed {
+				continue
+			}
+			if err := transitionAppointment(tx, &appt, proposal.PreviousStatus, Actor{Role: models.ActorSystem}, "Reschedule proposal expired"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// cancels a proposal that was left open when its appointment changed status
+func closeOpenProposals(tx *gorm.DB, appointmentID uint) error {
+	return tx.Model(&models.RescheduleProposal{}).
+		Where("appointment_id = ? AND status = ?", appointmentID, models.ProposalOpen).
+		Update("status", models.ProposalCancelled).Error
+}
+
+// emails the patients about the new times, only call it once the transaction is committed
+func notifyRescheduleProposals(proposalIDs []uint) {
+	if len(proposalIDs) == 0 {
+		return
+	}
+
+	go func() {
+		var proposals []models.RescheduleProposal
+		err := db.Db.Preload("Appointment.Patient").Preload("Appointment.Doctor.User").Find(&proposals, proposalIDs).Error
+		if err != nil {
+			fmt.Println("failed to load reschedule proposals", err)
+			return
+		}
+
+		for _, proposal := range proposals {
+			appt := proposal.Appointment
+			options := make([]string, len(proposal.Options))
+			for i, option := range proposal.Options {
+				options[i] = formatLocal(option, appt.Patient.TimeZone, "Monday 02 January 2006 at 15:04")
+			}
+
+			lines := []string{
+				fmt.Sprintf("Dr. %s %s would like to move your appointment of %s.", appt.Doctor.User.FirstName, appt.Doctor.User.LastName, formatLocal(appt.AppointmentDate, appt.Patient.TimeZone, "Monday 02 January 2006 at 15:04")),
+				"Proposed times: " + strings.Join(options, ", ") + ".",
+			}
+			if proposal.Note != "" {
+				lines = append(lines, "Note from the doctor: "+proposal.Note)
+			}
+			lines = append(lines, fmt.Sprintf("Accept one of them or decline in CareFlow before %s, declining cancels the appointment.", formatLocal(proposal.ExpiresAt, appt.Patient.TimeZone, "15:04 on 02 January")))
+
+			mails.SendNotification(appt.Patient.Email, mails.Notification{
+				Subject: "Dr. " + appt.Doctor.User.LastName + " proposed a new time for your appointment",
+				Heading: "New time proposed",
+				Lines:   lines,
+			})
+		}
+	}()
+}
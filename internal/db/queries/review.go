@@ -0,0 +1,396 @@
+package queries
+
+import (
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrReviewNotFound     = errors.New("Review not found")
+	ErrReviewNotPublished = errors.New("Only published reviews can be replied to")
+)
+
+// filters of the admin moderation queue
+const (
+	ModerationPending  = "pending"
+	ModerationReported = "reported"
+	ModerationHidden   = "hidden"
+)
+
+type ReviewBody struct {
+	Rating  int    `json:"rating" validate:"required,min=1,max=5"`
+	Comment string `json:"comment" validate:"max=2000"`
+}
+
+type ReviewReplyBody struct {
+	Reply string `json:"reply" validate:"required,max=2000"`
+}
+
+type ReviewReportBody struct {
+	Reason string `json:"reason" validate:"required,max=1000"`
+}
+
+type ModerateReviewBody struct {
+	Status string `json:"status" validate:"required,oneof=published hidden"`
+	// shown to the doctor and the author, required to hide a review
+	Reason string `json:"reason" validate:"required_if=Status hidden,max=1000"`
+}
+
+// what anyone can see of a published review, the author only by first name and initial
+type PublicReview struct {
+	ID        uint       `json:"id"`
+	Rating    int        `json:"rating"`
+	Comment   string     `json:"comment"`
+	Author    string     `json:"author"`
+	Reply     string     `json:"reply,omitempty"`
+	RepliedAt *time.Time `json:"repliedAt,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// a review as the doctor or an admin sees it, moderation fields included but the author
+// still only by first name and initial
+type ReviewDetails struct {
+	ID            uint   `json:"id"`
+	AppointmentID uint   `json:"appointmentId"`
+	DoctorID      uint   `json:"doctorId"`
+	Rating        int    `json:"rating"`
+	Comment       string `json:"comment"`
+	Author        string `json:"author"`
+	// only filled in the moderation queue
+	DoctorName string `json:"doctorName,omitempty"`
+
+	Reply     string     `json:"reply,omitempty"`
+	RepliedAt *time.Time `json:"repliedAt,omitempty"`
+	Status    string     `json:"status"`
+
+	ReportedAt       *time.Time `json:"reportedAt,omitempty"`
+	ReportReason     string     `json:"reportReason,omitempty"`
+	ModeratedAt      *time.Time `json:"moderatedAt,omitempty"`
+	ModerationReason string     `json:"moderationReason,omitempty"`
+
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+type PublicReviewPage struct {
+	Reviews  []PublicReview `json:"reviews"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+}
+
+// recomputes the doctor's average rating and review count from the published reviews,
+// callers hold the doctor row lock so concurrent changes don't overwrite each other
+func refreshDoctorRating(tx *gorm.DB, doctorID uint) error {
+	return tx.Exec(`
+		UPDATE doctors SET
+			average_rating = COALESCE((SELECT ROUND(AVG(rating), 2) FROM reviews WHERE doctor_id = ? AND status = ?), 0),
+			review_count = (SELECT COUNT(*) FROM reviews WHERE doctor_id = ? AND status = ?)
+		WHERE id = ?`,
+		doctorID, models.ReviewPublished, doctorID, models.ReviewPublished, doctorID).Error
+}
+
+func findReview(tx *gorm.DB, query string, args ...interface{}) (*models.Review, error) {
+	var review models.Review
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where(query, args...).First(&review).Error; err != nil {
+		return nil, ErrReviewNotFound
+	}
+	return &review, nil
+}
+
+// reviews one of the patient's completed appointments
+func CreateReview(patientID uint, appointmentID uint, body ReviewBody) (*models.Review, error) {
+	var review models.Review
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		var appt models.Appointment
+		if err := tx.Where("id = ? AND patient_id = ?", appointmentID, patientID).First(&appt).Error; err != nil {
+			return ErrAppointmentNotFound
+		}
+		if appt.Status != models.StatusCompleted {
+			return errors.New("Only completed appointments can be reviewed")
+		}
+
+		if _, err := lockDoctor(tx, appt.DoctorID); err != nil {
+			return err
+		}
+
+		var count int64
+		if err := tx.Model(&models.Review{}).Where("appointment_id = ?", appt.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errors.New("This appointment was already reviewed")
+		}
+
+		review = models.Review{
+			AppointmentID: appt.ID,
+			PatientID:     patientID,
+			DoctorID:      appt.DoctorID,
+			Rating:        body.Rating,
+			Comment:       strings.TrimSpace(body.Comment),
+			Status:        models.ReviewPublished,
+		}
+		if err := tx.Create(&review).Error; err != nil {
+			return err
+		}
+		return refreshDoctorRating(tx, appt.DoctorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &review, nil
+}
+
+// an edited review goes back to the moderation queue, a report made before the edit stays
+func editReview(review *models.Review, body ReviewBody) {
+	review.Rating = body.Rating
+	review.Comment = strings.TrimSpace(body.Comment)
+	review.ModeratedAt = nil
+}
+
+// changes the patient's review of the appointment, it goes back to the moderation queue
+func UpdateReview(patientID uint, appointmentID uint, body ReviewBody) (*models.Review, error) {
+	var review *models.Review
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		review, err = findReview(tx, "appointment_id = ? AND patient_id = ?", appointmentID, patientID)
+		if err != nil {
+			return err
+		}
+		if _, err := lockDoctor(tx, review.DoctorID); err != nil {
+			return err
+		}
+
+		editReview(review, body)
+		if err := tx.Save(review).Error; err != nil {
+			return err
+		}
+		return refreshDoctorRating(tx, review.DoctorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+func GetPatientReviews(patientID uint) ([]models.Review, error) {
+	var reviews []models.Review
+	err := db.Db.Preload("Doctor.User").
+		Where("patient_id = ?", patientID).
+		Order("created_at desc").
+		Find(&reviews).Error
+
+	return reviews, err
+}
+
+func newReviewDetails(review models.Review) ReviewDetails {
+	details := ReviewDetails{
+		ID:               review.ID,
+		AppointmentID:    review.AppointmentID,
+		DoctorID:         review.DoctorID,
+		Rating:           review.Rating,
+		Comment:          review.Comment,
+		Author:           reviewAuthor(review.Patient),
+		Reply:            review.Reply,
+		RepliedAt:        review.RepliedAt,
+		Status:           review.Status,
+		ReportedAt:       review.ReportedAt,
+		ReportReason:     review.ReportReason,
+		ModeratedAt:      review.ModeratedAt,
+		ModerationReason: review.ModerationReason,
+		CreatedAt:        review.CreatedAt,
+		UpdatedAt:        review.UpdatedAt,
+	}
+	if review.Doctor.User.ID != 0 {
+		details.DoctorName = review.Doctor.User.FirstName + " " + review.Doctor.User.LastName
+	}
+	return details
+}
+
+func newReviewDetailsList(reviews []models.Review) []ReviewDetails {
+	list := make([]ReviewDetails, len(reviews))
+	for i, review := range reviews {
+		list[i] = newReviewDetails(review)
+	}
+	return list
+}
+
+// every review of the doctor, hidden ones included
+func GetDoctorReviews(userID uint) ([]ReviewDetails, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var reviews []models.Review
+	err = db.Db.Preload("Patient", unscoped).
+		Where("doctor_id = ?", doctorID).
+		Order("created_at desc").
+		Find(&reviews).Error
+	if err != nil {
+		return nil, err
+	}
+
+	return newReviewDetailsList(reviews), nil
+}
+
+// hidden reviews can't be answered, the reply would be public once an admin publishes them again
+func replyToReview(review *models.Review, body ReviewReplyBody, now time.Time) error {
+	if review.Status != models.ReviewPublished {
+		return ErrReviewNotPublished
+	}
+	review.Reply = strings.TrimSpace(body.Reply)
+	review.RepliedAt = &now
+	return nil
+}
+
+// public answer of the doctor, replying again replaces it
+func ReplyToReview(userID uint, reviewID uint, body ReviewReplyBody) (*models.Review, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	review, err := findReview(db.Db, "id = ? AND doctor_id = ?", reviewID, doctorID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := replyToReview(review, body, time.Now()); err != nil {
+		return nil, err
+	}
+	if err := db.Db.Save(review).Error; err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// sends the review to the moderation queue
+func ReportReview(userID uint, reviewID uint, body ReviewReportBody) error {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return err
+	}
+
+	review, err := findReview(db.Db, "id = ? AND doctor_id = ?", reviewID, doctorID)
+	if err != nil {
+		return err
+	}
+	if review.Status == models.ReviewHidden {
+		return errors.New("This review is already hidden")
+	}
+
+	now := time.Now()
+	review.ReportedAt = &now
+	review.ReportReason = body.Reason
+	review.ModeratedAt = nil
+	return db.Db.Save(review).Error
+}
+
+// reviews waiting for an admin, reported ones first
+func GetModerationQueue(filter string) ([]ReviewDetails, error) {
+	query := db.Db.Preload("Patient", unscoped).Preload("Doctor.User")
+
+	switch filter {
+	case "", ModerationPending:
+		query = query.Where("moderated_at IS NULL").Order("reported_at IS NULL, reported_at, created_at")
+	case ModerationReported:
+		query = query.Where("moderated_at IS NULL AND reported_at IS NOT NULL").Order("reported_at")
+	case ModerationHidden:
+		query = query.Where("status = ?", models.ReviewHidden).Order("moderated_at desc")
+	default:
+		return nil, errors.New("Invalid filter. Use 'pending', 'reported' or 'hidden'")
+	}
+
+	var reviews []models.Review
+	if err := query.Find(&reviews).Error; err != nil {
+		return nil, err
+	}
+	return newReviewDetailsList(reviews), nil
+}
+
+// hides or publishes the review and updates the doctor's rating
+func ModerateReview(adminID uint, reviewID uint, body ModerateReviewBody) (*models.Review, error) {
+	var review *models.Review
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		review, err = findReview(tx, "id = ?", reviewID)
+		if err != nil {
+			return err
+		}
+		if _, err := lockDoctor(tx, review.DoctorID); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		review.Status = body.Status
+		review.ModeratedAt = &now
+		review.ModeratedByID = &adminID
+		review.ModerationReason = body.Reason
+		if err := tx.Save(review).Error; err != nil {
+			return err
+		}
+		return refreshDoctorRating(tx, review.DoctorID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return review, nil
+}
+
+// first name and initial of the last name
+func reviewAuthor(user models.User) string {
+	initial, _ := utf8.DecodeRuneInString(user.LastName)
+	if initial == utf8.RuneError {
+		return user.FirstName
+	}
+	return user.FirstName + " " + string(initial) + "."
+}
+
+// published reviews of a verified doctor, newest first
+func GetPublicReviews(doctorID uint, page, pageSize int) (*PublicReviewPage, error) {
+	var doctor models.Doctor
+	if err := db.Db.Where("id = ? AND is_verified = ?", doctorID, true).First(&doctor).Error; err != nil {
+		return nil, errors.New("Doctor not found")
+	}
+
+	result := &PublicReviewPage{Reviews: []PublicReview{}, Page: page, PageSize: pageSize}
+	query := db.Db.Model(&models.Review{}).Where("doctor_id = ? AND status = ?", doctor.ID, models.ReviewPublished)
+	if err := query.Count(&result.Total).Error; err != nil {
+		return nil, err
+	}
+
+	var reviews []models.Review
+	err := db.Db.Preload("Patient", unscoped).
+		Where("doctor_id = ? AND status = ?", doctor.ID, models.ReviewPublished).
+		Order("created_at desc, id desc").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&reviews).Error
+	if err != nil {
+		return nil, err
+	}
+
+	for _, review := range reviews {
+		result.Reviews = append(result.Reviews, PublicReview{
+			ID:        review.ID,
+			Rating:    review.Rating,
+			Comment:   review.Comment,
+			Author:    reviewAuthor(review.Patient),
+			Reply:     review.Reply,
+			RepliedAt: review.RepliedAt,
+			CreatedAt: review.CreatedAt,
+		})
+	}
+	return result, nil
+}
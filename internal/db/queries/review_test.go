@@ -0,0 +1,103 @@
+package queries
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db/models"
+)
+
+func TestEditReview(t *testing.T) {
+	moderated := time.Date(2026, 3, 1, 10, 0, 0, 0, time.UTC)
+	reported := time.Date(2026, 2, 28, 10, 0, 0, 0, time.UTC)
+
+	review := models.Review{
+		Rating:       2,
+		Comment:      "Long wait",
+		Status:       models.ReviewHidden,
+		ReportedAt:   &reported,
+		ReportReason: "rude",
+		ModeratedAt:  &moderated,
+	}
+	editReview(&review, ReviewBody{Rating: 4, Comment: "  Better the second time \n"})
+
+	if review.Rating != 4 || review.Comment != "Better the second time" {
+		t.Errorf("rating and comment = %d %q", review.Rating, review.Comment)
+	}
+	if review.ModeratedAt != nil {
+		t.Error("an edited review must go back to the moderation queue")
+	}
+	// the admin decides whether it becomes visible again
+	if review.Status != models.ReviewHidden {
+		t.Errorf("status = %q, want it unchanged", review.Status)
+	}
+	if review.ReportedAt == nil || review.ReportReason != "rude" {
+		t.Error("the report must stay for the admin")
+	}
+}
+
+func TestReplyToReview(t *testing.T) {
+	now := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	earlier := now.Add(-24 * time.Hour)
+
+	tests := []struct {
+		name      string
+		review    models.Review
+		reply     string
+		wantErr   error
+		wantReply string
+	}{
+		{"published review", models.Review{Status: models.ReviewPublished}, " Thank you! ", nil, "Thank you!"},
+		{"replying again replaces the reply", models.Review{Status: models.ReviewPublished, Reply: "Thanks", RepliedAt: &earlier}, "Thank you", nil, "Thank you"},
+		{"hidden review", models.Review{Status: models.ReviewHidden}, "Thank you", ErrReviewNotPublished, ""},
+		{"hidden review keeps its old reply", models.Review{Status: models.ReviewHidden, Reply: "Thanks", RepliedAt: &earlier}, "Thank you", ErrReviewNotPublished, "Thanks"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			review := tt.review
+			err := replyToReview(&review, ReviewReplyBody{Reply: tt.reply}, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("replyToReview() = %v, want %v", err, tt.wantErr)
+			}
+			if review.Reply != tt.wantReply {
+				t.Errorf("reply = %q, want %q", review.Reply, tt.wantReply)
+			}
+			if tt.wantErr == nil && (review.RepliedAt == nil || !review.RepliedAt.Equal(now)) {
+				t.Errorf("repliedAt = %v, want %v", review.RepliedAt, now)
+			}
+		})
+	}
+}
+
+func TestReviewDetailsHidesAuthor(t *testing.T) {
+	review := models.Review{
+		ID:      1,
+		Rating:  5,
+		Comment: "Great",
+		Status:  models.ReviewPublished,
+		Patient: models.User{ID: 7, FirstName: "Amira", LastName: "Ben Salah", Email: "amira@example.com"},
+		Doctor:  models.Doctor{User: models.User{ID: 3, FirstName: "Karim", LastName: "Haddad", Email: "karim@example.com"}},
+	}
+
+	details := newReviewDetails(review)
+	if details.Author != "Amira B." {
+		t.Errorf("author = %q, want %q", details.Author, "Amira B.")
+	}
+	if details.DoctorName != "Karim Haddad" {
+		t.Errorf("doctor name = %q", details.DoctorName)
+	}
+
+	body, err := json.Marshal(details)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, leaked := range []string{"amira@example.com", "Ben Salah", "karim@example.com", "patient"} {
+		if strings.Contains(string(body), leaked) {
+			t.Errorf("%s leaks %q", body, leaked)
+		}
+	}
+}
@@ -0,0 +1,378 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+)
+
+var ErrOutsideSchedule = errors.New("Requested time is outside the doctor's working hours")
+
+type ScheduleEntry struct {
+	DayOfWeek    int    `json:"dayOfWeek" validate:"min=0,max=6"`
+	StartTime    string `json:"startTime" validate:"required,datetime=15:04"`
+	EndTime      string `json:"endTime" validate:"required,datetime=15:04"`
+	BreakStart   string `json:"breakStart" validate:"omitempty,datetime=15:04"`
+	BreakEnd     string `json:"breakEnd" validate:"omitempty,datetime=15:04"`
+	SlotDuration int    `json:"slotDuration" validate:"required,min=5,max=240"`
+	// one of the doctor's locations
+	LocationID *uint `json:"locationId"`
+}
+
+type UpdateScheduleBody struct {
+	Schedule []ScheduleEntry `json:"schedule" validate:"dive"`
+}
+
+type Slot struct {
+	StartsAt time.Time `json:"startsAt"`
+	EndsAt   time.Time `json:"endsAt"`
+	// location of the schedule block the slot belongs to
+	LocationID *uint `json:"locationId,omitempty"`
+}
+
+// minutes since midnight of a HH:MM string
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func validateScheduleEntry(entry ScheduleEntry) error {
+	start, err := parseClock(entry.StartTime)
+	if err != nil {
+		return err
+	}
+	end, err := parseClock(entry.EndTime)
+	if err != nil {
+		return err
+	}
+	if start >= end {
+		return errors.New("startTime must be before endTime")
+	}
+	if end-start < entry.SlotDuration {
+		return errors.New("slotDuration is longer than the working block")
+	}
+
+	if (entry.BreakStart == "") != (entry.BreakEnd == "") {
+		return errors.New("breakStart and breakEnd must be set together")
+	}
+	if entry.BreakStart != "" {
+		breakStart, err := parseClock(entry.BreakStart)
+		if err != nil {
+			return err
+		}
+		breakEnd, err := parseClock(entry.BreakEnd)
+		if err != nil {
+			return err
+		}
+		if breakStart >= breakEnd || breakStart < start || breakEnd > end {
+			return errors.New("break must be inside the working block")
+		}
+	}
+	return nil
+}
+
+// checks every block and that the blocks of a same day don't overlap, times are compared
+// in minutes since "9:00" is a valid time too
+func validateScheduleEntries(entries []ScheduleEntry) error {
+	for i, entry := range entries {
+		if err := validateScheduleEntry(entry); err != nil {
+			return err
+		}
+		start, _ := parseClock(entry.StartTime)
+		end, _ := parseClock(entry.EndTime)
+
+		for _, other := range entries[:i] {
+			if other.DayOfWeek != entry.DayOfWeek {
+				continue
+			}
+			otherStart, _ := parseClock(other.StartTime)
+			otherEnd, _ := parseClock(other.EndTime)
+			if start < otherEnd && otherStart < end {
+				return fmt.Errorf("overlapping working hours on day %d", entry.DayOfWeek)
+			}
+		}
+	}
+	return nil
+}
+
+func GetDoctorSchedule(userID uint) ([]models.DoctorSchedule, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var schedules []models.DoctorSchedule
+	err = db.Db.Preload("Location").
+		Where("doctor_id = ?", doctorID).
+		Order("day_of_week, start_time").
+		Find(&schedules).Error
+
+	return schedules, err
+}
+
+// replaces the whole weekly schedule of the doctor
+func ReplaceDoctorSchedule(userID uint, body UpdateScheduleBody) ([]models.DoctorSchedule, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateScheduleEntries(body.Schedule); err != nil {
+		return nil, err
+	}
+
+	schedules := make([]models.DoctorSchedule, len(body.Schedule))
+	for i, entry := range body.Schedule {
+		if entry.LocationID != nil {
+			if err := ensureDoctorLocation(db.Db, doctorID, *entry.LocationID); err != nil {
+				return nil, err
+			}
+		}
+
+		schedules[i] = models.DoctorSchedule{
+			DoctorID:     doctorID,
+			DayOfWeek:    entry.DayOfWeek,
+			StartTime:    entry.StartTime,
+			EndTime:      entry.EndTime,
+			BreakStart:   entry.BreakStart,
+			BreakEnd:     entry.BreakEnd,
+			SlotDuration: entry.SlotDuration,
+			LocationID:   entry.LocationID,
+		}
+	}
+
+	err = db.Db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("doctor_id = ?", doctorID).Delete(&models.DoctorSchedule{}).Error; err != nil {
+			return err
+		}
+		if len(schedules) == 0 {
+			return nil
+		}
+		return tx.Create(&schedules).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return GetDoctorSchedule(userID)
+}
+
+func clockOn(day time.Time, minutes int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, day.Location())
+}
+
+// working periods of a schedule block on the given day, with the break cut out
+func scheduleSegments(schedule models.DoctorSchedule, day time.Time) [][2]time.Time {
+	start, _ := parseClock(schedule.StartTime)
+	end, _ := parseClock(schedule.EndTime)
+
+	if schedule.BreakStart == "" {
+		return [][2]time.Time{{clockOn(day, start), clockOn(day, end)}}
+	}
+
+	breakStart, _ := parseClock(schedule.BreakStart)
+	breakEnd, _ := parseClock(schedule.BreakEnd)
+	return [][2]time.Time{
+		{clockOn(day, start), clockOn(day, breakStart)},
+		{clockOn(day, breakEnd), clockOn(day, end)},
+	}
+}
+
+// every slot of the weekly schedule starting in [from, to). Slots start on the schedule grid
+// and last duration, or the schedule slot length when duration is 0. Days are walked in loc
+// so a working block keeps its wall clock hours across daylight saving changes
+func generateSlots(schedules []models.DoctorSchedule, from, to time.Time, loc *time.Location, duration time.Duration) []Slot {
+	var slots []Slot
+
+	local := from.In(loc)
+	for day := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc); day.Before(to); day = day.AddDate(0, 0, 1) {
+		for _, schedule := range schedules {
+			if schedule.DayOfWeek != int(day.Weekday()) {
+				continue
+			}
+
+			step := time.Duration(schedule.SlotDuration) * time.Minute
+			length := duration
+			if length == 0 {
+				length = step
+			}
+
+			for _, segment := range scheduleSegments(schedule, day) {
+				for start := segment[0]; !start.Add(length).After(segment[1]); start = start.Add(step) {
+					if start.Before(from) || !start.Before(to) {
+						continue
+					}
+					slots = append(slots, Slot{StartsAt: start, EndsAt: start.Add(length), LocationID: schedule.LocationID})
+				}
+			}
+		}
+	}
+
+	sort.Slice(slots, func(i, j int) bool { return slots[i].StartsAt.Before(slots[j].StartsAt) })
+	return slots
+}
+
+// returns the schedule slot starting exactly at the given time
+func findScheduleSlot(tx *gorm.DB, doctorID uint, at time.Time, duration time.Duration) (*Slot, error) {
+	loc := doctorLocation(tx, doctorID)
+
+	var schedules []models.DoctorSchedule
+	if err := tx.Where("doctor_id = ? AND day_of_week = ?", doctorID, int(at.In(loc).Weekday())).Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+
+	dayStart := startOfDay(at, loc)
+	for _, slot := range generateSlots(schedules, dayStart, dayStart.AddDate(0, 0, 1), loc, duration) {
+		if slot.StartsAt.Equal(at) {
+			return &slot, nil
+		}
+	}
+	return nil, ErrOutsideSchedule
+}
+
+// checks that a new appointment time is bookable with the doctor's schedule
+func validateAppointmentTime(tx *gorm.DB, doctorID uint, at time.Time, duration time.Duration) (*Slot, error) {
+	if at.IsZero() {
+		return nil, errors.New("Appointment date is required")
+	}
+	if !at.After(time.Now()) {
+		return nil, errors.New("Appointment date must be in the future")
+	}
+	return findScheduleSlot(tx, doctorID, at, duration)
+}
+
+// free slots of a verified doctor between from and to, sized for the appointment type when given
+// and limited to one of the doctor's locations when locationID is set
+func GetAvailableSlots(doctorID uint, from, to time.Time, appointmentTypeID *uint, locationID *uint) ([]Slot, error) {
+	var doctor models.Doctor
+	if err := db.Db.Where("id = ? AND is_verified = ?", doctorID, true).First(&doctor).Error; err != nil {
+		return nil, errors.New("Doctor not found")
+	}
+
+	appointmentType, err := resolveAppointmentType(db.Db, doctor.ID, appointmentTypeID)
+	if err != nil {
+		return nil, err
+	}
+	var duration time.Duration
+	if appointmentType != nil {
+		duration = time.Duration(appointmentType.DurationMinutes) * time.Minute
+	}
+
+	return freeSlots(&doctor, from, to, duration, locationID)
+}
+
+// slots of the doctor's schedule between from and to that nothing else holds
+func freeSlots(doctor *models.Doctor, from, to time.Time, duration time.Duration, locationID *uint) ([]Slot, error) {
+	slots := []Slot{}
+	if !doctor.IsAvailable {
+		return slots, nil
+	}
+
+	if now := time.Now(); from.Before(now) {
+		from = now
+	}
+	if !from.Before(to) {
+		return slots, nil
+	}
+
+	query := db.Db.Where("doctor_id = ?", doctor.ID)
+	if locationID != nil {
+		query = query.Where("location_id = ?", *locationID)
+	}
+
+	var schedules []models.DoctorSchedule
+	if err := query.Find(&schedules).Error; err != nil {
+		return nil, err
+	}
+	if len(schedules) == 0 {
+		return slots, nil
+	}
+
+	busy, err := busyPeriods([]uint{doctor.ID}, from.Add(-24*time.Hour), to.Add(24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+
+	return openSlots(generateSlots(schedules, from, to, loadLocation(doctor.TimeZone), duration), busy[doctor.ID]), nil
+}
+
+// the slots that don't overlap any of the busy periods
+func openSlots(slots []Slot, busy []Slot) []Slot {
+	open := []Slot{}
+	for _, slot := range slots {
+		free := true
+		for _, period := range busy {
+			if period.StartsAt.Before(slot.EndsAt) && period.EndsAt.After(slot.StartsAt) {
+				free = false
+				break
+			}
+		}
+		if free {
+			open = append(open, slot)
+		}
+	}
+	return open
+}
+
+// one busy period of a doctor, as scanned by busyPeriods
+type doctorBusyPeriod struct {
+	DoctorID uint
+	StartsAt time.Time
+	EndsAt   time.Time
+}
+
+// booked appointments, held waitlist offers, time off and external busy times overlapping
+// [from, to) of each of the doctors, in one query per kind whatever the number of doctors
+func busyPeriods(doctorIDs []uint, from, to time.Time) (map[uint][]Slot, error) {
+	var appointments []doctorBusyPeriod
+	err := db.Db.Model(&models.Appointment{}).
+		Select("doctor_id, appointment_date AS starts_at, ends_at").
+		Where("doctor_id IN ? AND status IN ? AND appointment_date < ? AND ends_at > ?", doctorIDs, models.ActiveStatuses, to, from).
+		Scan(&appointments).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var held []doctorBusyPeriod
+	err = db.Db.Model(&models.WaitlistEntry{}).
+		Select("doctor_id, offered_slot AS starts_at, offered_slot_end AS ends_at").
+		Where("doctor_id IN ? AND status = ? AND offer_expires_at > ? AND offered_slot < ? AND offered_slot_end > ?", doctorIDs, models.WaitlistOffered, time.Now(), to, from).
+		Scan(&held).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var timeOff []doctorBusyPeriod
+	err = db.Db.Model(&models.DoctorTimeOff{}).
+		Select("doctor_id, starts_at, ends_at").
+		Where("doctor_id IN ? AND starts_at < ? AND ends_at > ?", doctorIDs, to, from).
+		Scan(&timeOff).Error
+	if err != nil {
+		return nil, err
+	}
+
+	var external []doctorBusyPeriod
+	err = db.Db.Model(&models.ExternalBusyBlock{}).
+		Select("doctor_id, starts_at, ends_at").
+		Where("doctor_id IN ? AND starts_at < ? AND ends_at > ?", doctorIDs, to, from).
+		Scan(&external).Error
+	if err != nil {
+		return nil, err
+	}
+
+	busy := make(map[uint][]Slot, len(doctorIDs))
+	for _, kind := range [][]doctorBusyPeriod{appointments, held, timeOff, external} {
+		for _, period := range kind {
+			busy[period.DoctorID] = append(busy[period.DoctorID], Slot{StartsAt: period.StartsAt, EndsAt: period.EndsAt})
+		}
+	}
+	return busy, nil
+}
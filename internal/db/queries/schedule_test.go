@@ -0,0 +1,179 @@
+package queries
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db/models"
+)
+
+func TestGenerateSlots(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	weekend := []models.DoctorSchedule{
+		{DayOfWeek: int(time.Saturday), StartTime: "09:00", EndTime: "10:00", SlotDuration: 30},
+		{DayOfWeek: int(time.Sunday), StartTime: "09:00", EndTime: "10:00", SlotDuration: 30},
+	}
+	monday := func(schedule models.DoctorSchedule) []models.DoctorSchedule {
+		schedule.DayOfWeek = int(time.Monday)
+		return []models.DoctorSchedule{schedule}
+	}
+
+	tests := []struct {
+		name      string
+		schedules []models.DoctorSchedule
+		from      time.Time
+		to        time.Time
+		loc       *time.Location
+		duration  time.Duration
+		// slot starts in UTC
+		want []string
+	}{
+		{
+			name:      "clocks go forward on sunday",
+			schedules: weekend,
+			from:      time.Date(2026, 3, 28, 0, 0, 0, 0, paris),
+			to:        time.Date(2026, 3, 30, 0, 0, 0, 0, paris),
+			loc:       paris,
+			want:      []string{"2026-03-28 08:00", "2026-03-28 08:30", "2026-03-29 07:00", "2026-03-29 07:30"},
+		},
+		{
+			name:      "clocks go back on sunday",
+			schedules: weekend,
+			from:      time.Date(2026, 10, 24, 0, 0, 0, 0, paris),
+			to:        time.Date(2026, 10, 26, 0, 0, 0, 0, paris),
+			loc:       paris,
+			want:      []string{"2026-10-24 07:00", "2026-10-24 07:30", "2026-10-25 08:00", "2026-10-25 08:30"},
+		},
+		{
+			name:      "days are walked in the doctor's zone",
+			schedules: weekend,
+			// saturday 23:30 UTC is already sunday in Paris
+			from: time.Date(2026, 1, 10, 23, 30, 0, 0, time.UTC),
+			to:   time.Date(2026, 1, 11, 23, 0, 0, 0, time.UTC),
+			loc:  paris,
+			want: []string{"2026-01-11 08:00", "2026-01-11 08:30"},
+		},
+		{
+			name:      "break is cut out",
+			schedules: monday(models.DoctorSchedule{StartTime: "09:00", EndTime: "12:00", BreakStart: "10:00", BreakEnd: "11:00", SlotDuration: 60}),
+			from:      time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC),
+			to:        time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC),
+			loc:       time.UTC,
+			want:      []string{"2026-01-12 09:00", "2026-01-12 11:00"},
+		},
+		{
+			name:      "longer appointments must end in the block",
+			schedules: monday(models.DoctorSchedule{StartTime: "09:00", EndTime: "10:00", SlotDuration: 30}),
+			from:      time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC),
+			to:        time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC),
+			loc:       time.UTC,
+			duration:  45 * time.Minute,
+			want:      []string{"2026-01-12 09:00"},
+		},
+		{
+			name:      "slots before from are skipped",
+			schedules: monday(models.DoctorSchedule{StartTime: "09:00", EndTime: "10:00", SlotDuration: 30}),
+			from:      time.Date(2026, 1, 12, 9, 15, 0, 0, time.UTC),
+			to:        time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC),
+			loc:       time.UTC,
+			want:      []string{"2026-01-12 09:30"},
+		},
+		{
+			name:      "no schedule on that day",
+			schedules: weekend,
+			from:      time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC),
+			to:        time.Date(2026, 1, 13, 0, 0, 0, 0, time.UTC),
+			loc:       time.UTC,
+			want:      nil,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, slot := range generateSlots(tt.schedules, tt.from, tt.to, tt.loc, tt.duration) {
+				if tt.duration != 0 && slot.EndsAt.Sub(slot.StartsAt) != tt.duration {
+					t.Errorf("slot at %v lasts %v, want %v", slot.StartsAt, slot.EndsAt.Sub(slot.StartsAt), tt.duration)
+				}
+				got = append(got, slot.StartsAt.UTC().Format("2006-01-02 15:04"))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("generateSlots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateScheduleEntries(t *testing.T) {
+	block := func(day int, start, end string) ScheduleEntry {
+		return ScheduleEntry{DayOfWeek: day, StartTime: start, EndTime: end, SlotDuration: 30}
+	}
+
+	tests := []struct {
+		name    string
+		entries []ScheduleEntry
+		wantErr string
+	}{
+		{"morning and afternoon", []ScheduleEntry{block(1, "08:00", "12:00"), block(1, "14:00", "18:00")}, ""},
+		{"back to back", []ScheduleEntry{block(1, "08:00", "12:00"), block(1, "12:00", "13:00")}, ""},
+		{"same hours on other days", []ScheduleEntry{block(1, "08:00", "12:00"), block(2, "08:00", "12:00")}, ""},
+		{"overlapping", []ScheduleEntry{block(1, "08:00", "12:00"), block(1, "11:00", "13:00")}, "overlapping working hours on day 1"},
+		// "9:00" sorts after "10:00" as a string
+		{"single digit hour overlapping", []ScheduleEntry{block(1, "08:30", "10:00"), block(1, "9:00", "11:00")}, "overlapping working hours on day 1"},
+		{"single digit hour before", []ScheduleEntry{block(1, "10:00", "12:00"), block(1, "8:00", "9:30")}, ""},
+		{"invalid time", []ScheduleEntry{block(1, "8h", "12:00")}, "invalid time"},
+		{"end before start", []ScheduleEntry{block(1, "12:00", "08:00")}, "startTime must be before endTime"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateScheduleEntries(tt.entries)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("validateScheduleEntries() = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("validateScheduleEntries() = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestOpenSlots(t *testing.T) {
+	at := func(hour, minute int) time.Time { return time.Date(2026, 1, 12, hour, minute, 0, 0, time.UTC) }
+	slots := []Slot{
+		{StartsAt: at(9, 0), EndsAt: at(9, 30)},
+		{StartsAt: at(9, 30), EndsAt: at(10, 0)},
+		{StartsAt: at(10, 0), EndsAt: at(10, 30)},
+	}
+
+	tests := []struct {
+		name string
+		busy []Slot
+		want []string
+	}{
+		{"nothing busy", nil, []string{"09:00", "09:30", "10:00"}},
+		{"booked slot", []Slot{{StartsAt: at(9, 30), EndsAt: at(10, 0)}}, []string{"09:00", "10:00"}},
+		{"busy period ending when a slot starts", []Slot{{StartsAt: at(8, 0), EndsAt: at(9, 0)}}, []string{"09:00", "09:30", "10:00"}},
+		{"busy period across several slots", []Slot{{StartsAt: at(9, 15), EndsAt: at(10, 5)}}, []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, slot := range openSlots(slots, tt.busy) {
+				got = append(got, slot.StartsAt.Format("15:04"))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("openSlots() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
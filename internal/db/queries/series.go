@@ -0,0 +1,338 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// which occurrences of a series a cancel or reschedule applies to
+const (
+	ScopeSingle    = "single"
+	ScopeFollowing = "following"
+)
+
+const maxSeriesOccurrences = 52
+
+type AppointmentSeriesRequest struct {
+	DoctorID          uint  `json:"doctorId" validate:"required"`
+	AppointmentTypeID *uint `json:"appointmentTypeId"`
+	// date of the first occurrence
+	AppointmentDate time.Time `json:"appointmentDate" validate:"required"`
+	Reason          string    `json:"reason"`
+	// books for one of the patient's dependents instead of the patient
+	DependentID *uint `json:"dependentId"`
+	// every occurrence must fall in working hours at this location
+	LocationID *uint `json:"locationId"`
+
+	Frequency string `json:"frequency" validate:"required,oneof=weekly monthly"`
+	Interval  int    `json:"interval" validate:"omitempty,min=1,max=12"`
+
+	// either a number of occurrences or an end date
+	Count int        `json:"count" validate:"omitempty,min=2,max=52"`
+	Until *time.Time `json:"until"`
+}
+
+// adds months without overflowing into the next one (jan 31 + 1 month = feb 28)
+func addMonths(t time.Time, months int) time.Time {
+	firstOfMonth := time.Date(t.Year(), t.Month()+time.Month(months), 1, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+	lastDay := firstOfMonth.AddDate(0, 1, -1).Day()
+
+	day := t.Day()
+	if day > lastDay {
+		day = lastDay
+	}
+	return time.Date(firstOfMonth.Year(), firstOfMonth.Month(), day, t.Hour(), t.Minute(), t.Second(), 0, t.Location())
+}
+
+func occurrenceDates(req AppointmentSeriesRequest, loc *time.Location) ([]time.Time, error) {
+	if req.Count == 0 && req.Until == nil {
+		return nil, errors.New("Either count or until is required")
+	}
+
+	interval := req.Interval
+	if interval == 0 {
+		interval = 1
+	}
+
+	// keep the same wall clock time even across daylight saving changes
+	first := req.AppointmentDate.In(loc)
+
+	var dates []time.Time
+	for i := 0; req.Count == 0 || i < req.Count; i++ {
+		next := first.AddDate(0, 0, 7*interval*i)
+		if req.Frequency == models.FrequencyMonthly {
+			next = addMonths(first, interval*i)
+		}
+
+		if req.Until != nil && next.After(*req.Until) {
+			break
+		}
+		if len(dates) == maxSeriesOccurrences {
+			return nil, fmt.Errorf("A series cannot have more than %d occurrences", maxSeriesOccurrences)
+		}
+		dates = append(dates, next)
+	}
+
+	if len(dates) < 2 {
+		return nil, errors.New("A series needs at least two occurrences")
+	}
+	return dates, nil
+}
+
+func CreateAppointmentSeries(patientID uint, req AppointmentSeriesRequest) (*models.AppointmentSeries, error) {
+	dates, err := occurrenceDates(req, DoctorLocation(req.DoctorID))
+	if err != nil {
+		return nil, err
+	}
+
+	series := models.AppointmentSeries{
+		PatientID:   patientID,
+		DoctorID:    req.DoctorID,
+		Frequency:   req.Frequency,
+		Interval:    max(req.Interval, 1),
+		Occurrences: len(dates),
+		Until:       req.Until,
+	}
+
+	err = db.Db.Transaction(func(tx *gorm.DB) error {
+		doctor, err := lockDoctor(tx, req.DoctorID)
+		if err != nil {
+			return err
+		}
+		if !doctor.IsAvailable {
+			return errors.New("Doctor is currently unavailable")
+		}
+		if err := ensureCanBook(tx, patientID); err != nil {
+			return err
+		}
+		if err := resolveDependent(tx, patientID, req.DependentID); err != nil {
+			return err
+		}
+
+		appointmentType, err := resolveAppointmentType(tx, doctor.ID, req.AppointmentTypeID)
+		if err != nil {
+			return err
+		}
+
+		if err := tx.Create(&series).Error; err != nil {
+			return err
+		}
+
+		// the whole series is rejected if any occurrence can't be booked
+		for _, date := range dates {
+			appointment, err := bookAppointment(tx, booking{
+				PatientID:   patientID,
+				DependentID: req.DependentID,
+				DoctorID:    doctor.ID,
+				Date:        date,
+				Reason:      req.Reason,
+				Type:        appointmentType,
+				SeriesID:    &series.ID,
+				LocationID:  req.LocationID,
+			})
+			if err != nil {
+				return fmt.Errorf("Occurrence on %s: %w", date.Format("2006-01-02 15:04"), bookingError(err))
+			}
+
+			// like a single booking, the series goes through with the warnings attached
+			appointment.Warnings, err = coverageWarnings(tx, patientID, req.DependentID, doctor.ID, appointment.AppointmentDate)
+			if err != nil {
+				return err
+			}
+			series.Appointments = append(series.Appointments, *appointment)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	localizeAppointments(series.Appointments, userLocation(patientID))
+	return &series, nil
+}
+
+// the appointment alone, or with every later active occurrence of its series
+func selectOccurrences(tx *gorm.DB, appt *models.Appointment, scope string) ([]models.Appointment, error) {
+	switch scope {
+	case "", ScopeSingle:
+		return []models.Appointment{*appt}, nil
+	case ScopeFollowing:
+	default:
+		return nil, errors.New("Invalid scope. Use 'single' or 'following'")
+	}
+
+	if appt.SeriesID == nil || !isActiveStatus(appt.Status) {
+		return []models.Appointment{*appt}, nil
+	}
+
+	var occurrences []models.Appointment
+	err := tx.Where("series_id = ? AND appointment_date >= ? AND status IN ?", *appt.SeriesID, appt.AppointmentDate, models.ActiveStatuses).
+		Order("appointment_date, id").
+		Find(&occurrences).Error
+	if err != nil {
+		return nil, err
+	}
+	return occurrences, nil
+}
+
+// cancels the occurrences and offers every freed slot to the doctor's waitlist. Occurrences of a
+// series still inside the notice window are kept and returned, it only fails when all of them are
+func cancelOccurrences(tx *gorm.DB, occurrences []models.Appointment, actor Actor, req CancelAppointmentRequest) ([]models.WaitlistEntry, []uint, error) {
+	policy, err := getBookingPolicy(tx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	reason := req.Reason
+	if reason == "" {
+		reason = req.ReasonCode
+	}
+
+	var offers []models.WaitlistEntry
+	var tooLate []uint
+	for i := range occurrences {
+		if err := applyCancellationPolicy(policy, &occurrences[i], actor, req); err != nil {
+			if errors.Is(err, ErrCancellationTooLate) && len(occurrences) > 1 {
+				tooLate = append(tooLate, occurrences[i].ID)
+				continue
+			}
+			return nil, nil, err
+		}
+		if err := transitionAppointment(tx, &occurrences[i], models.StatusCancelled, actor, reason); err != nil {
+			return nil, nil, err
+		}
+
+		freed := Slot{StartsAt: occurrences[i].AppointmentDate, EndsAt: occurrences[i].EndsAt}
+		offer, err := offerSlot(tx, occurrences[i].DoctorID, freed)
+		if err != nil {
+			return nil, nil, err
+		}
+		if offer != nil {
+			offers = append(offers, *offer)
+		}
+	}
+	if len(tooLate) == len(occurrences) {
+		return nil, nil, ErrCancellationTooLate
+	}
+	return offers, tooLate, nil
+}
+
+func calendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// new time of each occurrence when the first one moves to newDate: the others are shifted
+// by the same number of days, all of them taking the new wall clock time
+func shiftedDates(occurrences []models.Appointment, newDate time.Time, loc *time.Location) []time.Time {
+	oldFirst := occurrences[0].AppointmentDate.In(loc)
+	newFirst := newDate.In(loc)
+	dayShift := int(calendarDay(newFirst).Sub(calendarDay(oldFirst)).Hours() / 24)
+
+	targets := make([]time.Time, len(occurrences))
+	for i, occurrence := range occurrences {
+		local := occurrence.AppointmentDate.In(loc)
+		targets[i] = time.Date(local.Year(), local.Month(), local.Day()+dayShift, newFirst.Hour(), newFirst.Minute(), 0, 0, loc)
+	}
+	return targets
+}
+
+var ErrNotMovable = errors.New("Only pending, confirmed or to be rescheduled appointments can be moved")
+
+// statuses a patient can give a new date, a visit already under way keeps its time
+var movableStatuses = []string{models.StatusPending, models.StatusConfirmed, models.StatusNeedsReschedule}
+
+func isMovableStatus(status string) bool {
+	for _, movable := range movableStatuses {
+		if status == movable {
+			return true
+		}
+	}
+	return false
+}
+
+// fails before anything moves when one of the occurrences can't be given a new date
+func ensureMovable(occurrences []models.Appointment) error {
+	for _, occurrence := range occurrences {
+		if occurrence.Status == models.StatusRescheduleProposed {
+			return fmt.Errorf("Occurrence on %s has an open reschedule proposal, answer it first", occurrence.AppointmentDate.Format("2006-01-02 15:04"))
+		}
+		if !isMovableStatus(occurrence.Status) {
+			return fmt.Errorf("%w, the one on %s is %s", ErrNotMovable, occurrence.AppointmentDate.Format("2006-01-02 15:04"), occurrence.Status)
+		}
+	}
+	return nil
+}
+
+// moves the occurrences to their shifted dates
+// ids of the occurrences being moved together, the slots they free up can be reused by each other
+func occurrenceIDs(occurrences []models.Appointment) []uint {
+	ids := make([]uint, len(occurrences))
+	for i, occurrence := range occurrences {
+		ids[i] = occurrence.ID
+	}
+	return ids
+}
+
+func moveOccurrences(tx *gorm.DB, occurrences []models.Appointment, newDate time.Time, actor Actor) error {
+	if err := ensureMovable(occurrences); err != nil {
+		return err
+	}
+
+	targets := shiftedDates(occurrences, newDate, doctorLocation(tx, occurrences[0].DoctorID))
+
+	ids := occurrenceIDs(occurrences)
+
+	// move the last occurrence first when going forward so that no two of them
+	// ever hold the same slot at the same time
+	order := make([]int, len(occurrences))
+	for i := range order {
+		order[i] = i
+		if newDate.After(occurrences[0].AppointmentDate) {
+			order[i] = len(occurrences) - 1 - i
+		}
+	}
+
+	for _, i := range order {
+		occurrence := &occurrences[i]
+		target := targets[i]
+
+		duration := time.Duration(occurrence.DurationMinutes) * time.Minute
+		_, slot, err := reserveSlot(tx, occurrence.DoctorID, target, duration, ids...)
+		if err != nil {
+			return fmt.Errorf("Occurrence on %s: %w", target.Format("2006-01-02 15:04"), err)
+		}
+		occurrence.AppointmentDate = slot.StartsAt
+		occurrence.EndsAt = slot.EndsAt
+		occurrence.LocationID = slot.LocationID
+
+		// picking a new time closes the reschedule request, the doctor still has to
+		// confirm the ones chosen by the patient
+		if occurrence.Status == models.StatusNeedsReschedule {
+			to := models.StatusPending
+			if actor.Role == models.ActorDoctor {
+				to = models.StatusConfirmed
+			}
+			if err := transitionAppointment(tx, occurrence, to, actor, "Rescheduled"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// a date change by the patient needs a new confirmation from the doctor
+		if actor.Role == models.ActorPatient && occurrence.Status == models.StatusConfirmed {
+			if err := transitionAppointment(tx, occurrence, models.StatusPending, actor, "Rescheduled by patient"); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := tx.Save(occurrence).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
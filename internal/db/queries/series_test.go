@@ -0,0 +1,195 @@
+package queries
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db/models"
+)
+
+func formatLocalDates(dates []time.Time, loc *time.Location) []string {
+	formatted := make([]string, len(dates))
+	for i, date := range dates {
+		formatted[i] = date.In(loc).Format("2006-01-02 15:04")
+	}
+	return formatted
+}
+
+func TestShiftedDates(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// weekly at 09:00 in Paris, the clocks go forward between the second and third one
+	series := []models.Appointment{
+		{AppointmentDate: time.Date(2026, 3, 15, 9, 0, 0, 0, paris)},
+		{AppointmentDate: time.Date(2026, 3, 22, 9, 0, 0, 0, paris)},
+		{AppointmentDate: time.Date(2026, 3, 29, 9, 0, 0, 0, paris)},
+	}
+
+	tests := []struct {
+		name    string
+		newDate time.Time
+		want    []string
+	}{
+		{
+			name:    "one day later",
+			newDate: time.Date(2026, 3, 16, 9, 0, 0, 0, paris),
+			want:    []string{"2026-03-16 09:00", "2026-03-23 09:00", "2026-03-30 09:00"},
+		},
+		{
+			name:    "another time the same day",
+			newDate: time.Date(2026, 3, 15, 14, 30, 0, 0, paris),
+			want:    []string{"2026-03-15 14:30", "2026-03-22 14:30", "2026-03-29 14:30"},
+		},
+		{
+			name:    "two days earlier",
+			newDate: time.Date(2026, 3, 13, 8, 0, 0, 0, paris),
+			want:    []string{"2026-03-13 08:00", "2026-03-20 08:00", "2026-03-27 08:00"},
+		},
+		{
+			// 23:30 UTC is already the next day in Paris
+			name:    "new date read in the doctor's zone",
+			newDate: time.Date(2026, 3, 15, 23, 30, 0, 0, time.UTC),
+			want:    []string{"2026-03-16 00:30", "2026-03-23 00:30", "2026-03-30 00:30"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatLocalDates(shiftedDates(series, tt.newDate, paris), paris)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("shiftedDates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShiftBySeriesInterval(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	series := make([]models.Appointment, 3)
+	for i := range series {
+		start := time.Date(2026, 3, 15+7*i, 9, 0, 0, 0, paris)
+		series[i] = models.Appointment{ID: uint(10 + i), AppointmentDate: start, EndsAt: start.Add(30 * time.Minute)}
+	}
+
+	// a week later puts every occurrence but the last one on the slot of the next
+	targets := shiftedDates(series, series[1].AppointmentDate, paris)
+	excluded := occurrenceIDs(series)
+	if !reflect.DeepEqual(excluded, []uint{10, 11, 12}) {
+		t.Fatalf("occurrenceIDs() = %v", excluded)
+	}
+
+	for i, target := range targets {
+		end := target.Add(30 * time.Minute)
+		for _, other := range series {
+			if !other.AppointmentDate.Before(end) || !other.EndsAt.After(target) {
+				continue
+			}
+			found := false
+			for _, id := range excluded {
+				found = found || id == other.ID
+			}
+			if !found {
+				t.Errorf("occurrence %d lands on %d which still counts as taken", series[i].ID, other.ID)
+			}
+		}
+	}
+}
+
+func TestOccurrenceDates(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+	until := time.Date(2026, 4, 6, 18, 0, 0, 0, paris)
+
+	tests := []struct {
+		name    string
+		req     AppointmentSeriesRequest
+		want    []string
+		wantErr bool
+	}{
+		{
+			name: "weekly keeps the wall clock time across daylight saving",
+			req:  AppointmentSeriesRequest{AppointmentDate: time.Date(2026, 3, 22, 8, 0, 0, 0, time.UTC), Frequency: models.FrequencyWeekly, Count: 3},
+			want: []string{"2026-03-22 09:00", "2026-03-29 09:00", "2026-04-05 09:00"},
+		},
+		{
+			name: "every two weeks until a date",
+			req:  AppointmentSeriesRequest{AppointmentDate: time.Date(2026, 3, 9, 9, 0, 0, 0, paris), Frequency: models.FrequencyWeekly, Interval: 2, Until: &until},
+			want: []string{"2026-03-09 09:00", "2026-03-23 09:00", "2026-04-06 09:00"},
+		},
+		{
+			name: "monthly on the 31st falls back to the last day",
+			req:  AppointmentSeriesRequest{AppointmentDate: time.Date(2026, 1, 31, 10, 0, 0, 0, paris), Frequency: models.FrequencyMonthly, Count: 3},
+			want: []string{"2026-01-31 10:00", "2026-02-28 10:00", "2026-03-31 10:00"},
+		},
+		{
+			name:    "count or until is required",
+			req:     AppointmentSeriesRequest{AppointmentDate: time.Date(2026, 3, 9, 9, 0, 0, 0, paris), Frequency: models.FrequencyWeekly},
+			wantErr: true,
+		},
+		{
+			name:    "until before the second occurrence",
+			req:     AppointmentSeriesRequest{AppointmentDate: time.Date(2026, 4, 1, 9, 0, 0, 0, paris), Frequency: models.FrequencyWeekly, Until: &until},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dates, err := occurrenceDates(tt.req, paris)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("occurrenceDates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if got := formatLocalDates(dates, paris); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("occurrenceDates() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEnsureMovable(t *testing.T) {
+	at := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	occurrence := func(status string) models.Appointment {
+		return models.Appointment{Status: status, AppointmentDate: at}
+	}
+
+	tests := []struct {
+		name        string
+		occurrences []models.Appointment
+		wantErr     bool
+		// the error is the 409 one for visits that can't move
+		wantNotMovable bool
+	}{
+		{"pending", []models.Appointment{occurrence(models.StatusPending)}, false, false},
+		{"confirmed", []models.Appointment{occurrence(models.StatusConfirmed)}, false, false},
+		{"needs reschedule", []models.Appointment{occurrence(models.StatusNeedsReschedule)}, false, false},
+		{"checked in", []models.Appointment{occurrence(models.StatusCheckedIn)}, true, true},
+		{"in progress", []models.Appointment{occurrence(models.StatusInProgress)}, true, true},
+		{"completed", []models.Appointment{occurrence(models.StatusCompleted)}, true, true},
+		{"open proposal", []models.Appointment{occurrence(models.StatusRescheduleProposed)}, true, false},
+		{"one started occurrence stops the series", []models.Appointment{occurrence(models.StatusConfirmed), occurrence(models.StatusInProgress)}, true, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ensureMovable(tt.occurrences)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ensureMovable() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if errors.Is(err, ErrNotMovable) != tt.wantNotMovable {
+				t.Errorf("ensureMovable() error = %v, want ErrNotMovable %v", err, tt.wantNotMovable)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/pkg/mails"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrTimeOffNotFound = errors.New("Time off not found")
+	ErrDoctorOnTimeOff = errors.New("The doctor is not available at this time")
+)
+
+type TimeOffRequest struct {
+	Kind     string    `json:"kind" validate:"required,oneof=vacation conference sick_leave"`
+	StartsAt time.Time `json:"startsAt" validate:"required"`
+	EndsAt   time.Time `json:"endsAt" validate:"required,gtfield=StartsAt"`
+	Note     string    `json:"note"`
+}
+
+type TimeOffResponse struct {
+	TimeOff models.DoctorTimeOff `json:"timeOff"`
+	// appointments moved to needs_reschedule because of it
+	AffectedAppointments int `json:"affectedAppointments"`
+}
+
+// statuses of the upcoming appointments a new time off period sends back to the patient
+var timeOffSweptStatuses = []string{models.StatusPending, models.StatusConfirmed, models.StatusRescheduleProposed}
+
+var timeOffLabels = map[string]string{
+	models.TimeOffVacation:   "vacation",
+	models.TimeOffConference: "a conference",
+	models.TimeOffSickLeave:  "sick leave",
+}
+
+func GetDoctorTimeOff(userID uint) ([]models.DoctorTimeOff, error) {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var periods []models.DoctorTimeOff
+	err = db.Db.Where("doctor_id = ? AND ends_at > ?", doctorID, time.Now()).
+		Order("starts_at").
+		Find(&periods).Error
+
+	return periods, err
+}
+
+// fails with ErrDoctorOnTimeOff if the slot overlaps one of the doctor's time off periods
+func ensureNotOnTimeOff(tx *gorm.DB, doctorID uint, slot Slot) error {
+	var count int64
+	err := tx.Model(&models.DoctorTimeOff{}).
+		Where("doctor_id = ? AND starts_at < ? AND ends_at > ?", doctorID, slot.EndsAt, slot.StartsAt).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDoctorOnTimeOff
+	}
+	return nil
+}
+
+// adds a time off period and asks the patients booked inside it to pick another time
+func CreateTimeOff(userID uint, req TimeOffRequest) (*TimeOffResponse, error) {
+	if !req.EndsAt.After(time.Now()) {
+		return nil, errors.New("endsAt must be in the future")
+	}
+
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var result TimeOffResponse
+	var affected []uint
+
+	err = db.Db.Transaction(func(tx *gorm.DB) error {
+		// no new booking can slip in while the period is being created
+		if _, err := lockDoctor(tx, doctorID); err != nil {
+			return err
+		}
+
+		result.TimeOff = models.DoctorTimeOff{
+			DoctorID: doctorID,
+			Kind:     req.Kind,
+			StartsAt: req.StartsAt,
+			EndsAt:   req.EndsAt,
+			Note:     req.Note,
+		}
+		if err := tx.Create(&result.TimeOff).Error; err != nil {
+			return err
+		}
+
+		// visits already underway or in the past are left alone
+		var appointments []models.Appointment
+		err := tx.Where("doctor_id = ? AND status IN ? AND appointment_date > ? AND appointment_date < ? AND ends_at > ?", doctorID, timeOffSweptStatuses, time.Now(), req.EndsAt, req.StartsAt).
+			Find(&appointments).Error
+		if err != nil {
+			return err
+		}
+
+		actor := Actor{UserID: userID, Role: models.ActorDoctor}
+		reason := "Doctor unavailable: " + timeOffLabels[req.Kind]
+		for i := range appointments {
+			if err := transitionAppointment(tx, &appointments[i], models.StatusNeedsReschedule, actor, reason); err != nil {
+				return err
+			}
+			affected = append(affected, appointments[i].ID)
+		}
+
+		// open waitlist offers inside the period go back to waiting
+		return tx.Model(&models.WaitlistEntry{}).
+			Where("doctor_id = ? AND status = ? AND offered_slot < ? AND offered_slot_end > ?", doctorID, models.WaitlistOffered, req.EndsAt, req.StartsAt).
+			Updates(map[string]interface{}{
+				"status":           models.WaitlistWaiting,
+				"offered_slot":     nil,
+				"offered_slot_end": nil,
+				"offer_expires_at": nil,
+			}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result.AffectedAppointments = len(affected)
+	notifyRescheduleNeeded(affected, req.Kind)
+	return &result, nil
+}
+
+// deleting a period does not bring back the appointments it displaced
+func DeleteTimeOff(userID uint, timeOffID uint) error {
+	doctorID, err := getDoctorID(userID)
+	if err != nil {
+		return err
+	}
+
+	result := db.Db.Where("id = ? AND doctor_id = ?", timeOffID, doctorID).Delete(&models.DoctorTimeOff{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTimeOffNotFound
+	}
+	return nil
+}
+
+// emails the patients whose appointment has to be moved, only call it once the transaction is committed
+func notifyRescheduleNeeded(appointmentIDs []uint, kind string) {
+	if len(appointmentIDs) == 0 {
+		return
+	}
+
+	go func() {
+		var appointments []models.Appointment
+		if err := db.Db.Preload("Patient").Preload("Doctor.User").Find(&appointments, appointmentIDs).Error; err != nil {
+			fmt.Println("failed to load appointments to reschedule", err)
+			return
+		}
+
+		for _, appt := range appointments {
+			mails.SendNotification(appt.Patient.Email, mails.Notification{
+				Subject: "Your appointment with Dr. " + appt.Doctor.User.LastName + " needs a new time",
+				Heading: "Please reschedule your appointment",
+				Lines: []string{
+					fmt.Sprintf("Dr. %s %s is unavailable due to %s on %s.", appt.Doctor.User.FirstName, appt.Doctor.User.LastName, timeOffLabels[kind], formatLocal(appt.AppointmentDate, appt.Patient.TimeZone, "Monday 02 January 2006 at 15:04")),
+					"Pick a new time for this appointment in CareFlow, or cancel it if you no longer need it.",
+				},
+			})
+		}
+	}()
+}
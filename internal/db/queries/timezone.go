@@ -0,0 +1,80 @@
+package queries
+
+import (
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"gorm.io/gorm"
+)
+
+// loads an IANA time zone, an empty or unknown name falls back to UTC
+func loadLocation(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil || name == "" {
+		return time.UTC
+	}
+	return loc
+}
+
+// time zone the doctor's schedule wall clock times are expressed in
+func doctorLocation(tx *gorm.DB, doctorID uint) *time.Location {
+	var zone string
+	tx.Model(&models.Doctor{}).Where("id = ?", doctorID).Select("time_zone").Scan(&zone)
+	return loadLocation(zone)
+}
+
+func DoctorLocation(doctorID uint) *time.Location {
+	return doctorLocation(db.Db, doctorID)
+}
+
+// time zone the user reads dates in
+func userLocationTx(tx *gorm.DB, userID uint) *time.Location {
+	var zone string
+	tx.Model(&models.User{}).Where("id = ?", userID).Select("time_zone").Scan(&zone)
+	return loadLocation(zone)
+}
+
+func userLocation(userID uint) *time.Location {
+	return userLocationTx(db.Db, userID)
+}
+
+// formats a time for an email in the recipient's zone, with the zone name so there is no doubt
+func formatLocal(t time.Time, zone string, layout string) string {
+	return t.In(loadLocation(zone)).Format(layout + " MST")
+}
+
+// expresses the appointment times in the viewer's zone, the json then carries their offset
+func localizeAppointment(appointment *models.Appointment, loc *time.Location) {
+	appointment.AppointmentDate = appointment.AppointmentDate.In(loc)
+	appointment.EndsAt = appointment.EndsAt.In(loc)
+}
+
+func localizeAppointments(appointments []models.Appointment, loc *time.Location) {
+	for i := range appointments {
+		localizeAppointment(&appointments[i], loc)
+	}
+}
+
+func localizeOptionalTime(t *time.Time, loc *time.Location) *time.Time {
+	if t == nil {
+		return nil
+	}
+	local := t.In(loc)
+	return &local
+}
+
+// the preferred range and the open offer of the entry in the viewer's zone
+func localizeWaitlistEntry(entry *models.WaitlistEntry, loc *time.Location) {
+	entry.PreferredFrom = entry.PreferredFrom.In(loc)
+	entry.PreferredTo = entry.PreferredTo.In(loc)
+	entry.OfferedSlot = localizeOptionalTime(entry.OfferedSlot, loc)
+	entry.OfferedSlotEnd = localizeOptionalTime(entry.OfferedSlotEnd, loc)
+	entry.OfferExpiresAt = localizeOptionalTime(entry.OfferExpiresAt, loc)
+}
+
+// midnight of the day t falls on, in loc
+func startOfDay(t time.Time, loc *time.Location) time.Time {
+	local := t.In(loc)
+	return time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+}
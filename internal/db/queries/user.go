@@ -2,6 +2,7 @@ package queries
 
 import (
 	"errors"
+	"strings"
 	"time"
 
 	"github.com/YahiaJouini/careflow/pkg/mails"
@@ -11,6 +12,29 @@ import (
 	"github.com/YahiaJouini/careflow/internal/db/models"
 )
 
+var ErrDoctorHasAppointments = errors.New("You still have upcoming appointments, add a time off period so those patients are asked to reschedule before turning availability off")
+
+// fails with ErrDoctorHasAppointments when the doctor still has pending or upcoming appointments,
+// they would be left in place by turning availability off
+func ensureNoUpcomingAppointments(tx *gorm.DB, doctorID uint) error {
+	// no booking can slip in until the change is committed
+	if _, err := lockDoctor(tx, doctorID); err != nil {
+		return err
+	}
+
+	var count int64
+	err := tx.Model(&models.Appointment{}).
+		Where("doctor_id = ? AND status IN ? AND (status = ? OR ends_at > ?)", doctorID, models.ActiveStatuses, models.StatusPending, time.Now()).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count > 0 {
+		return ErrDoctorHasAppointments
+	}
+	return nil
+}
+
 func GetUserByID(userID uint) (*models.User, error) {
 	var user models.User
 
@@ -38,11 +62,26 @@ type UpdateUserBody struct {
 	FirstName *string `json:"firstName" validate:"omitempty,min=3,max=30"`
 	LastName  *string `json:"lastName" validate:"omitempty,min=3,max=30"`
 	Image     *string `json:"image" validate:"omitempty,url"`
+	// IANA zone like Europe/Paris
+	TimeZone *string `json:"timeZone" validate:"omitempty,timezone"`
 
 	// doctor fields
 	Bio             *string  `json:"bio" validate:"omitempty,max=500"`
 	ConsultationFee *float64 `json:"consultationFee" validate:"omitempty,gte=0"`
 	IsAvailable     *bool    `json:"isAvailable" validate:"omitempty"`
+	// zone of the practice, the weekly schedule is read in it
+	PracticeTimeZone *string `json:"practiceTimeZone" validate:"omitempty,timezone"`
+	// each list replaces the stored one when sent
+	Languages            []string     `json:"languages" validate:"omitempty,max=10,dive,len=2,alpha"`
+	Education            []DegreeBody `json:"education" validate:"omitempty,max=20,dive"`
+	YearsOfExperience    *int         `json:"yearsOfExperience" validate:"omitempty,min=0,max=70"`
+	HospitalAffiliations []string     `json:"hospitalAffiliations" validate:"omitempty,max=10,dive,required,max=150"`
+}
+
+type DegreeBody struct {
+	Title       string `json:"title" validate:"required,max=150"`
+	Institution string `json:"institution" validate:"required,max=150"`
+	Year        int    `json:"year" validate:"omitempty,min=1900,max=2100"`
 }
 
 func UpdateUser(userID uint, body UpdateUserBody) (*models.User, error) {
@@ -63,6 +102,9 @@ func UpdateUser(userID uint, body UpdateUserBody) (*models.User, error) {
 		if body.Image != nil {
 			updatedUser.Image = *body.Image
 		}
+		if body.TimeZone != nil {
+			updatedUser.TimeZone = *body.TimeZone
+		}
 
 		if err := tx.Save(&updatedUser).Error; err != nil {
 			return err
@@ -81,8 +123,36 @@ func UpdateUser(userID uint, body UpdateUserBody) (*models.User, error) {
 				updatedUser.Doctor.ConsultationFee = *body.ConsultationFee
 			}
 			if body.IsAvailable != nil {
+				if updatedUser.Doctor.IsAvailable && !*body.IsAvailable {
+					if err := ensureNoUpcomingAppointments(tx, updatedUser.Doctor.ID); err != nil {
+						return err
+					}
+				}
 				updatedUser.Doctor.IsAvailable = *body.IsAvailable
 			}
+			if body.PracticeTimeZone != nil {
+				updatedUser.Doctor.TimeZone = *body.PracticeTimeZone
+			}
+			if body.Languages != nil {
+				languages := make([]string, len(body.Languages))
+				for i, language := range body.Languages {
+					languages[i] = strings.ToLower(language)
+				}
+				updatedUser.Doctor.Languages = languages
+			}
+			if body.Education != nil {
+				education := make([]models.Degree, len(body.Education))
+				for i, degree := range body.Education {
+					education[i] = models.Degree{Title: degree.Title, Institution: degree.Institution, Year: degree.Year}
+				}
+				updatedUser.Doctor.Education = education
+			}
+			if body.YearsOfExperience != nil {
+				updatedUser.Doctor.YearsOfExperience = *body.YearsOfExperience
+			}
+			if body.HospitalAffiliations != nil {
+				updatedUser.Doctor.HospitalAffiliations = body.HospitalAffiliations
+			}
 
 			if err := tx.Save(&updatedUser.Doctor).Error; err != nil {
 				return err
@@ -0,0 +1,371 @@
+package queries
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/db"
+	"github.com/YahiaJouini/careflow/internal/db/models"
+	"github.com/YahiaJouini/careflow/pkg/mails"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrWaitlistEntryNotFound = errors.New("Waitlist entry not found")
+
+type WaitlistRequest struct {
+	DoctorID          uint      `json:"doctorId" validate:"required"`
+	AppointmentTypeID *uint     `json:"appointmentTypeId"`
+	PreferredFrom     time.Time `json:"preferredFrom" validate:"required"`
+	PreferredTo       time.Time `json:"preferredTo" validate:"required,gtfield=PreferredFrom"`
+	Reason            string    `json:"reason"`
+}
+
+func JoinWaitlist(patientID uint, req WaitlistRequest) (*models.WaitlistEntry, error) {
+	if !req.PreferredTo.After(time.Now()) {
+		return nil, errors.New("preferredTo must be in the future")
+	}
+
+	var doctor models.Doctor
+	if err := db.Db.Where("id = ? AND is_verified = ?", req.DoctorID, true).First(&doctor).Error; err != nil {
+		return nil, errors.New("Doctor not found")
+	}
+
+	if _, err := resolveAppointmentType(db.Db, doctor.ID, req.AppointmentTypeID); err != nil {
+		return nil, err
+	}
+
+	var count int64
+	db.Db.Model(&models.WaitlistEntry{}).
+		Where("patient_id = ? AND doctor_id = ? AND status IN ?", patientID, doctor.ID, []string{models.WaitlistWaiting, models.WaitlistOffered}).
+		Count(&count)
+	if count > 0 {
+		return nil, errors.New("You are already on this doctor's waitlist")
+	}
+
+	entry := models.WaitlistEntry{
+		PatientID:         patientID,
+		DoctorID:          doctor.ID,
+		AppointmentTypeID: req.AppointmentTypeID,
+		PreferredFrom:     req.PreferredFrom,
+		PreferredTo:       req.PreferredTo,
+		Reason:            req.Reason,
+		Status:            models.WaitlistWaiting,
+	}
+	if err := db.Db.Create(&entry).Error; err != nil {
+		return nil, err
+	}
+
+	localizeWaitlistEntry(&entry, userLocation(patientID))
+	return &entry, nil
+}
+
+func GetPatientWaitlist(patientID uint) ([]models.WaitlistEntry, error) {
+	var entries []models.WaitlistEntry
+	err := db.Db.Preload("Doctor").Preload("Doctor.User").Preload("AppointmentType").
+		Where("patient_id = ?", patientID).
+		Order("created_at desc").
+		Find(&entries).Error
+
+	loc := userLocation(patientID)
+	for i := range entries {
+		localizeWaitlistEntry(&entries[i], loc)
+	}
+	return entries, err
+}
+
+// offers a freed slot to the first waiting patient whose preferred range covers it
+// and whose appointment type fits in it, returns nil when nobody is waiting for it
+func offerSlot(tx *gorm.DB, doctorID uint, freed Slot, excludeIDs ...uint) (*models.WaitlistEntry, error) {
+	at := freed.StartsAt
+	if !at.After(time.Now()) {
+		return nil, nil
+	}
+
+	var doctor models.Doctor
+	if err := tx.First(&doctor, doctorID).Error; err != nil {
+		return nil, err
+	}
+	if !doctor.IsAvailable {
+		return nil, nil
+	}
+	if err := ensureNotOnTimeOff(tx, doctorID, freed); err != nil {
+		if errors.Is(err, ErrDoctorOnTimeOff) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	// the doctor may have filled the time in their own calendar
+	if err := ensureSlotFree(tx, doctorID, freed); err != nil {
+		if errors.Is(err, ErrSlotTaken) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	policy, err := getBookingPolicy(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	query := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+		Preload("AppointmentType").
+		Where("doctor_id = ? AND status = ? AND preferred_from <= ? AND preferred_to >= ?", doctorID, models.WaitlistWaiting, at, at).
+		Order("created_at, id")
+	if len(excludeIDs) > 0 {
+		query = query.Where("id NOT IN ?", excludeIDs)
+	}
+
+	var candidates []models.WaitlistEntry
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	for _, entry := range candidates {
+		var duration time.Duration
+		if entry.AppointmentType != nil {
+			duration = time.Duration(entry.AppointmentType.DurationMinutes) * time.Minute
+		}
+
+		// the appointment booked from the offer, of the type's length or the schedule slot length,
+		// must fit in the freed gap
+		slot, err := findScheduleSlot(tx, doctorID, at, duration)
+		if errors.Is(err, ErrOutsideSchedule) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if slot.EndsAt.After(freed.EndsAt) {
+			continue
+		}
+
+		expiresAt := time.Now().Add(time.Duration(policy.WaitlistOfferMinutes) * time.Minute)
+		entry.Status = models.WaitlistOffered
+		entry.OfferedSlot = &slot.StartsAt
+		entry.OfferedSlotEnd = &slot.EndsAt
+		entry.OfferExpiresAt = &expiresAt
+
+		if err := tx.Omit("AppointmentType").Save(&entry).Error; err != nil {
+			return nil, err
+		}
+		return &entry, nil
+	}
+	return nil, nil
+}
+
+// slot held by an open offer
+func offeredInterval(entry *models.WaitlistEntry) Slot {
+	return Slot{StartsAt: *entry.OfferedSlot, EndsAt: *entry.OfferedSlotEnd}
+}
+
+// emails the patients that just received an offer, only call it once the transaction is committed
+func notifyWaitlistOffers(entries []models.WaitlistEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	ids := make([]uint, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+
+	go func() {
+		var offers []models.WaitlistEntry
+		if err := db.Db.Preload("Patient").Preload("Doctor.User").Find(&offers, ids).Error; err != nil {
+			fmt.Println("failed to load waitlist offers", err)
+			return
+		}
+
+		for _, offer := range offers {
+			mails.SendNotification(offer.Patient.Email, mails.Notification{
+				Subject: "A slot opened up with Dr. " + offer.Doctor.User.LastName,
+				Heading: "A slot is available for you",
+				Lines: []string{
+					fmt.Sprintf("Dr. %s %s has a free slot on %s.", offer.Doctor.User.FirstName, offer.Doctor.User.LastName, formatLocal(*offer.OfferedSlot, offer.Patient.TimeZone, "Monday 02 January 2006 at 15:04")),
+					fmt.Sprintf("It is held for you until %s, accept it from your waitlist in CareFlow to book it.", formatLocal(*offer.OfferExpiresAt, offer.Patient.TimeZone, "15:04 on 02 January")),
+				},
+			})
+		}
+	}()
+}
+
+// expires open offers that were not answered in time and passes their slot to the next patient
+func ExpireWaitlistOffers() error {
+	var offers []models.WaitlistEntry
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		var expired []models.WaitlistEntry
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE", Options: "SKIP LOCKED"}).
+			Where("status = ? AND offer_expires_at <= ?", models.WaitlistOffered, time.Now()).
+			Find(&expired).Error
+		if err != nil {
+			return err
+		}
+
+		for _, entry := range expired {
+			entry.Status = models.WaitlistExpired
+			if err := tx.Save(&entry).Error; err != nil {
+				return err
+			}
+
+			offer, err := offerSlot(tx, entry.DoctorID, offeredInterval(&entry))
+			if err != nil {
+				return err
+			}
+			if offer != nil {
+				offers = append(offers, *offer)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	notifyWaitlistOffers(offers)
+	return nil
+}
+
+func findPatientWaitlistEntry(tx *gorm.DB, patientID uint, entryID uint) (*models.WaitlistEntry, error) {
+	var entry models.WaitlistEntry
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("id = ? AND patient_id = ?", entryID, patientID).
+		First(&entry).Error
+	if err != nil {
+		return nil, ErrWaitlistEntryNotFound
+	}
+	return &entry, nil
+}
+
+func openOffer(entry *models.WaitlistEntry) error {
+	if entry.Status != models.WaitlistOffered {
+		return errors.New("There is no open offer for this waitlist entry")
+	}
+	if !entry.OfferExpiresAt.After(time.Now()) {
+		return errors.New("This offer has expired")
+	}
+	return nil
+}
+
+// books the offered slot for the patient
+func AcceptWaitlistOffer(patientID uint, entryID uint) (*models.Appointment, error) {
+	var appointment *models.Appointment
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		entry, err := findPatientWaitlistEntry(tx, patientID, entryID)
+		if err != nil {
+			return err
+		}
+		if err := openOffer(entry); err != nil {
+			return err
+		}
+
+		// drop the hold first so the booking checks don't see it
+		entry.Status = models.WaitlistAccepted
+		if err := tx.Save(entry).Error; err != nil {
+			return err
+		}
+
+		if _, err := lockDoctor(tx, entry.DoctorID); err != nil {
+			return err
+		}
+		if err := ensureCanBook(tx, patientID); err != nil {
+			return err
+		}
+
+		appointmentType, err := resolveAppointmentType(tx, entry.DoctorID, entry.AppointmentTypeID)
+		if err != nil {
+			return err
+		}
+
+		appointment, err = bookAppointment(tx, booking{
+			PatientID: patientID,
+			DoctorID:  entry.DoctorID,
+			Date:      *entry.OfferedSlot,
+			Reason:    entry.Reason,
+			Type:      appointmentType,
+		})
+		if err != nil {
+			return err
+		}
+
+		entry.AppointmentID = &appointment.ID
+		return tx.Save(entry).Error
+	})
+	if err != nil {
+		return nil, bookingError(err)
+	}
+
+	localizeAppointment(appointment, userLocation(patientID))
+	return appointment, nil
+}
+
+// puts the patient back in line and passes the slot to the next one
+func DeclineWaitlistOffer(patientID uint, entryID uint) error {
+	var offer *models.WaitlistEntry
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		entry, err := findPatientWaitlistEntry(tx, patientID, entryID)
+		if err != nil {
+			return err
+		}
+		if err := openOffer(entry); err != nil {
+			return err
+		}
+
+		slot := offeredInterval(entry)
+		entry.Status = models.WaitlistWaiting
+		entry.OfferedSlot = nil
+		entry.OfferedSlotEnd = nil
+		entry.OfferExpiresAt = nil
+		if err := tx.Save(entry).Error; err != nil {
+			return err
+		}
+
+		offer, err = offerSlot(tx, entry.DoctorID, slot, entry.ID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if offer != nil {
+		notifyWaitlistOffers([]models.WaitlistEntry{*offer})
+	}
+	return nil
+}
+
+func LeaveWaitlist(patientID uint, entryID uint) error {
+	var offer *models.WaitlistEntry
+
+	err := db.Db.Transaction(func(tx *gorm.DB) error {
+		entry, err := findPatientWaitlistEntry(tx, patientID, entryID)
+		if err != nil {
+			return err
+		}
+		if entry.Status != models.WaitlistWaiting && entry.Status != models.WaitlistOffered {
+			return errors.New("This waitlist entry is already closed")
+		}
+
+		wasOffered := entry.Status == models.WaitlistOffered && entry.OfferExpiresAt.After(time.Now())
+		entry.Status = models.WaitlistCancelled
+		if err := tx.Save(entry).Error; err != nil {
+			return err
+		}
+
+		if wasOffered {
+			offer, err = offerSlot(tx, entry.DoctorID, offeredInterval(entry))
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	if offer != nil {
+		notifyWaitlistOffers([]models.WaitlistEntry{*offer})
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package jobs
+
+import (
+	"log"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/config"
+	"github.com/YahiaJouini/careflow/internal/db/queries"
+)
+
+// reminders sent before confirmed appointments unless REMINDER_OFFSETS is set,
+// e.g. REMINDER_OFFSETS=48h,24h,1h
+var defaultReminderOffsets = []time.Duration{24 * time.Hour, time.Hour}
+
+// runs fn in the background every interval, a failed run is logged and retried on the next tick
+func every(name string, interval time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			if err := fn(); err != nil {
+				log.Println(name, "failed:", err)
+			}
+		}
+	}()
+}
+
+// longest offset first, invalid entries are skipped
+func reminderOffsets() []time.Duration {
+	value, err := config.GetEnv("REMINDER_OFFSETS")
+	if err != nil || strings.TrimSpace(value) == "" {
+		return defaultReminderOffsets
+	}
+
+	var offsets []time.Duration
+	for _, part := range strings.Split(value, ",") {
+		offset, err := time.ParseDuration(strings.TrimSpace(part))
+		if err != nil || offset < time.Minute {
+			log.Println("ignoring invalid reminder offset", part)
+			continue
+		}
+		offsets = append(offsets, offset)
+	}
+	if len(offsets) == 0 {
+		return defaultReminderOffsets
+	}
+
+	sort.Slice(offsets, func(i, j int) bool { return offsets[i] > offsets[j] })
+	return offsets
+}
+
+// starts the periodic jobs, call it once the database is migrated
+func Start() {
+	offsets := reminderOffsets()
+	every("appointment reminders", time.Minute, func() error {
+		return queries.SendAppointmentReminders(offsets)
+	})
+
+	every("stale appointment expiry", 5*time.Minute, queries.ExpireStaleAppointments)
+	every("calendar sync", 5*time.Minute, queries.SyncCalendars)
+	every("idempotency record cleanup", time.Hour, queries.DeleteExpiredIdempotencyRecords)
+	// answering an offer or a proposal checks its expiry, until the next run reads may still show it open
+	every("waitlist offer expiry", time.Minute, queries.ExpireWaitlistOffers)
+	every("reschedule proposal expiry", time.Minute, queries.ExpireRescheduleProposals)
+}
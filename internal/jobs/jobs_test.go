@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestReminderOffsets(t *testing.T) {
+	tests := []struct {
+		name  string
+		value string
+		want  []time.Duration
+	}{
+		{"unset uses the defaults", "", defaultReminderOffsets},
+		{"blank uses the defaults", "  ", defaultReminderOffsets},
+		{"sorted longest first", "1h,48h,24h", []time.Duration{48 * time.Hour, 24 * time.Hour, time.Hour}},
+		{"spaces are trimmed", " 2h , 30m ", []time.Duration{2 * time.Hour, 30 * time.Minute}},
+		{"invalid entries are skipped", "24h,soon,1h", []time.Duration{24 * time.Hour, time.Hour}},
+		{"offsets under a minute are skipped", "30s,1h", []time.Duration{time.Hour}},
+		{"nothing valid uses the defaults", "soon,-1h", defaultReminderOffsets},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("REMINDER_OFFSETS", tt.value)
+			if got := reminderOffsets(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reminderOffsets() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/YahiaJouini/careflow/internal/config"
+)
+
+// prefix of the values sealed by EncryptSecret, anything else is a value stored before encryption
+const secretPrefix = "v1:"
+
+// AES-256-GCM with a key derived from ENCRYPTION_KEY
+func secretCipher() (cipher.AEAD, error) {
+	secret, err := config.GetEnv("ENCRYPTION_KEY")
+	if err != nil || secret == "" {
+		return nil, errors.New("ENCRYPTION_KEY is not set")
+	}
+
+	key := sha256.Sum256([]byte(secret))
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// seals a secret that has to be read back later, like the password of an external service
+func EncryptSecret(plain string) (string, error) {
+	if plain == "" {
+		return "", nil
+	}
+
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plain), nil)
+	return secretPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func IsEncryptedSecret(value string) bool {
+	return strings.HasPrefix(value, secretPrefix)
+}
+
+func DecryptSecret(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	if !IsEncryptedSecret(value) {
+		return "", errors.New("secret is not encrypted")
+	}
+
+	aead, err := secretCipher()
+	if err != nil {
+		return "", err
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, secretPrefix))
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", errors.New("invalid encrypted secret")
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", errors.New("invalid encrypted secret")
+	}
+	return string(plain), nil
+}
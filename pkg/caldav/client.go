@@ -0,0 +1,323 @@
+package caldav
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/YahiaJouini/careflow/internal/config"
+	"github.com/YahiaJouini/careflow/pkg/ical"
+)
+
+const timeRangeFormat = "20060102T150405Z"
+
+var ErrForbiddenHost = errors.New("The calendar must be on a public host")
+
+// "this network" and carrier-grade NAT ranges, not covered by net.IP.IsPrivate
+var reservedNetworks = []*net.IPNet{
+	{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)},
+	{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)},
+}
+
+// hosts reachable even though they are not public, and over plain http, read from
+// CALDAV_ALLOWED_HOSTS (comma separated host names, addresses or networks, e.g.
+// "radicale,127.0.0.1,10.0.0.0/8"). Empty unless set, only meant for local testing
+type allowList struct {
+	hosts    map[string]bool
+	networks []*net.IPNet
+}
+
+func loadAllowList() allowList {
+	allowed := allowList{hosts: map[string]bool{}}
+	value, err := config.GetEnv("CALDAV_ALLOWED_HOSTS")
+	if err != nil {
+		return allowed
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			allowed.networks = append(allowed.networks, network)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * len(ip.To16())
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 32
+			}
+			allowed.networks = append(allowed.networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		allowed.hosts[entry] = true
+	}
+	return allowed
+}
+
+func (a allowList) allowsIP(ip net.IP) bool {
+	for _, network := range a.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// host name or address of a url, as written in it
+func (a allowList) allowsHost(host string) bool {
+	if a.hosts[strings.ToLower(host)] {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && a.allowsIP(ip)
+}
+
+// only public unicast addresses can be reached, so a calendar url can't be used to call
+// services of the server's own network
+func publicIP(ip net.IP) bool {
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, network := range reservedNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// checked again when dialing, after the name was resolved, so a host that later resolves
+// to an internal address is refused as well
+func dialControl(allowed allowList) func(network, address string, _ syscall.RawConn) error {
+	return func(network, address string, _ syscall.RawConn) error {
+		host, _, err := net.SplitHostPort(address)
+		if err != nil {
+			return err
+		}
+		ip := net.ParseIP(host)
+		if ip == nil || (!publicIP(ip) && !allowed.allowsIP(ip)) {
+			return ErrForbiddenHost
+		}
+		return nil
+	}
+}
+
+// checks that a calendar url is https and that its host only resolves to public addresses,
+// hosts of CALDAV_ALLOWED_HOSTS are accepted as they are
+func ValidateURL(ctx context.Context, collectionURL string) error {
+	parsed, err := url.Parse(collectionURL)
+	if err != nil || parsed.Host == "" {
+		return errors.New("Invalid calendar url")
+	}
+	if parsed.User != nil {
+		return errors.New("Put the calendar credentials in username and password, not in the url")
+	}
+	if loadAllowList().allowsHost(parsed.Hostname()) {
+		if parsed.Scheme != "https" && parsed.Scheme != "http" {
+			return errors.New("The calendar url must use http or https")
+		}
+		return nil
+	}
+	if parsed.Scheme != "https" {
+		return errors.New("The calendar url must use https")
+	}
+
+	addresses, err := net.DefaultResolver.LookupIPAddr(ctx, parsed.Hostname())
+	if err != nil || len(addresses) == 0 {
+		return errors.New("The calendar host could not be resolved")
+	}
+	for _, address := range addresses {
+		if !publicIP(address.IP) {
+			return ErrForbiddenHost
+		}
+	}
+	return nil
+}
+
+// client for a single calendar collection, e.g. https://caldav.example.com/doctor/appointments/
+type Client struct {
+	collection string
+	username   string
+	password   string
+	// plain http is only accepted for hosts of CALDAV_ALLOWED_HOSTS
+	allowHTTP bool
+	http      *http.Client
+}
+
+func NewClient(collectionURL, username, password string) *Client {
+	if !strings.HasSuffix(collectionURL, "/") {
+		collectionURL += "/"
+	}
+
+	allowed := loadAllowList()
+	dialer := &net.Dialer{Timeout: 10 * time.Second, Control: dialControl(allowed)}
+	// allowed host names resolve to internal addresses, they are dialed without the check
+	open := &net.Dialer{Timeout: 10 * time.Second}
+	transport := &http.Transport{
+		// no proxy, the address check must apply to the calendar server itself
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, address string) (net.Conn, error) {
+			if host, _, err := net.SplitHostPort(address); err == nil && allowed.hosts[strings.ToLower(host)] {
+				return open.DialContext(ctx, network, address)
+			}
+			return dialer.DialContext(ctx, network, address)
+		},
+		TLSHandshakeTimeout: 10 * time.Second,
+	}
+
+	var allowHTTP bool
+	if parsed, err := url.Parse(collectionURL); err == nil {
+		allowHTTP = allowed.allowsHost(parsed.Hostname())
+	}
+
+	return &Client{
+		collection: collectionURL,
+		username:   username,
+		password:   password,
+		allowHTTP:  allowHTTP,
+		http: &http.Client{
+			Timeout:   30 * time.Second,
+			Transport: transport,
+			// redirects are answered as errors, the credentials are only sent to the configured url
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+	}
+}
+
+func (c *Client) eventURL(uid string) string {
+	return c.collection + url.PathEscape(uid) + ".ics"
+}
+
+func (c *Client) do(ctx context.Context, method, target string, body []byte, headers map[string]string) (*http.Response, error) {
+	if !strings.HasPrefix(target, "https://") && !(c.allowHTTP && strings.HasPrefix(target, "http://")) {
+		return nil, errors.New("The calendar url must use https")
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	return c.http.Do(req)
+}
+
+// only the status is kept, the body is never shown back to the doctor
+func statusError(method string, resp *http.Response) error {
+	return fmt.Errorf("caldav %s failed: %s", method, resp.Status)
+}
+
+// creates or replaces the event stored under uid
+func (c *Client) PutEvent(ctx context.Context, uid string, calendar *ical.Calendar) error {
+	var body bytes.Buffer
+	if err := calendar.Encode(&body); err != nil {
+		return err
+	}
+
+	resp, err := c.do(ctx, http.MethodPut, c.eventURL(uid), body.Bytes(), map[string]string{
+		"Content-Type": "text/calendar; charset=utf-8",
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return statusError("PUT", resp)
+	}
+	return nil
+}
+
+// removes the event stored under uid, missing events are not an error
+func (c *Client) DeleteEvent(ctx context.Context, uid string) error {
+	resp, err := c.do(ctx, http.MethodDelete, c.eventURL(uid), nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		return statusError("DELETE", resp)
+	}
+	return nil
+}
+
+type multistatus struct {
+	Responses []struct {
+		Href      string `xml:"href"`
+		Propstats []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				CalendarData string `xml:"calendar-data"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+// events overlapping [from, to), recurring events are expanded by the server
+func (c *Client) Events(ctx context.Context, from, to time.Time, loc *time.Location) ([]ical.Event, error) {
+	start := from.UTC().Format(timeRangeFormat)
+	end := to.UTC().Format(timeRangeFormat)
+	query := fmt.Sprintf(`<?xml version="1.0" encoding="utf-8"?>
+<C:calendar-query xmlns:D="DAV:" xmlns:C="urn:ietf:params:xml:ns:caldav">
+  <D:prop>
+    <C:calendar-data>
+      <C:expand start="%s" end="%s"/>
+    </C:calendar-data>
+  </D:prop>
+  <C:filter>
+    <C:comp-filter name="VCALENDAR">
+      <C:comp-filter name="VEVENT">
+        <C:time-range start="%s" end="%s"/>
+      </C:comp-filter>
+    </C:comp-filter>
+  </C:filter>
+</C:calendar-query>`, start, end, start, end)
+
+	resp, err := c.do(ctx, "REPORT", c.collection, []byte(query), map[string]string{
+		"Content-Type": "application/xml; charset=utf-8",
+		"Depth":        "1",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, statusError("REPORT", resp)
+	}
+
+	var result multistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, errors.New("caldav REPORT: invalid response")
+	}
+
+	var events []ical.Event
+	for _, response := range result.Responses {
+		for _, propstat := range response.Propstats {
+			if propstat.Prop.CalendarData == "" {
+				continue
+			}
+			parsed, err := ical.Decode(strings.NewReader(propstat.Prop.CalendarData), loc)
+			if err != nil {
+				return nil, fmt.Errorf("caldav REPORT: invalid event: %w", err)
+			}
+			events = append(events, parsed...)
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,202 @@
+package ical
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var durationPattern = regexp.MustCompile(`^([+-])?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// one property line split into name, parameters and value
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+// joins folded lines back together
+func unfold(r io.Reader) ([]string, error) {
+	var lines []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines, scanner.Err()
+}
+
+func parseProperty(line string) (property, bool) {
+	// the value starts at the first colon outside of a quoted parameter
+	inQuotes := false
+	split := -1
+	for i, c := range line {
+		if c == '"' {
+			inQuotes = !inQuotes
+		}
+		if c == ':' && !inQuotes {
+			split = i
+			break
+		}
+	}
+	if split < 0 {
+		return property{}, false
+	}
+
+	parts := strings.Split(line[:split], ";")
+	prop := property{name: strings.ToUpper(parts[0]), params: map[string]string{}, value: line[split+1:]}
+	for _, param := range parts[1:] {
+		if key, value, ok := strings.Cut(param, "="); ok {
+			prop.params[strings.ToUpper(key)] = strings.Trim(value, `"`)
+		}
+	}
+	return prop, true
+}
+
+func unescape(value string) string {
+	replacer := strings.NewReplacer(`\n`, "\n", `\N`, "\n", `\,`, ",", `\;`, ";", `\\`, `\`)
+	return replacer.Replace(value)
+}
+
+// date or date-time value, floating times use the TZID parameter or loc
+func parseTime(prop property, loc *time.Location) (time.Time, bool, error) {
+	if tzid, ok := prop.params["TZID"]; ok {
+		if zone, err := time.LoadLocation(tzid); err == nil {
+			loc = zone
+		}
+	}
+
+	value := prop.value
+	switch {
+	case prop.params["VALUE"] == "DATE" || len(value) == 8:
+		t, err := time.ParseInLocation("20060102", value, loc)
+		return t, true, err
+	case strings.HasSuffix(value, "Z"):
+		t, err := time.Parse(timestampFormat, value)
+		return t, false, err
+	default:
+		t, err := time.ParseInLocation("20060102T150405", value, loc)
+		return t, false, err
+	}
+}
+
+func parseDuration(value string) (time.Duration, error) {
+	match := durationPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total time.Duration
+	for i, unit := range units {
+		if match[i+2] == "" {
+			continue
+		}
+		n, _ := strconv.Atoi(match[i+2])
+		total += time.Duration(n) * unit
+	}
+	if match[1] == "-" {
+		total = -total
+	}
+	return total, nil
+}
+
+// reads the events of an iCalendar document, times without a zone are read in loc.
+// Recurrence rules are not expanded
+func Decode(r io.Reader, loc *time.Location) ([]Event, error) {
+	lines, err := unfold(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	var current *Event
+	var duration time.Duration
+	var allDay bool
+	// components nested in an event (alarms) are skipped
+	nested := 0
+
+	for _, line := range lines {
+		prop, ok := parseProperty(line)
+		if !ok {
+			continue
+		}
+
+		switch {
+		case prop.name == "BEGIN" && strings.EqualFold(prop.value, "VEVENT"):
+			current = &Event{}
+			duration, allDay = 0, false
+			continue
+		case current == nil:
+			continue
+		case prop.name == "BEGIN":
+			nested++
+			continue
+		case prop.name == "END" && nested > 0:
+			nested--
+			continue
+		case nested > 0:
+			continue
+		case prop.name == "END" && strings.EqualFold(prop.value, "VEVENT"):
+			if current.Start.IsZero() {
+				return nil, errors.New("event without DTSTART")
+			}
+			if current.End.IsZero() {
+				switch {
+				case duration > 0:
+					current.End = current.Start.Add(duration)
+				case allDay:
+					current.End = current.Start.AddDate(0, 0, 1)
+				default:
+					current.End = current.Start
+				}
+			}
+			events = append(events, *current)
+			current = nil
+			continue
+		}
+
+		switch prop.name {
+		case "UID":
+			current.UID = unescape(prop.value)
+		case "SUMMARY":
+			current.Summary = unescape(prop.value)
+		case "DESCRIPTION":
+			current.Description = unescape(prop.value)
+		case "LOCATION":
+			current.Location = unescape(prop.value)
+		case "STATUS":
+			current.Status = strings.ToUpper(prop.value)
+		case "TRANSP":
+			current.Transparent = strings.EqualFold(prop.value, "TRANSPARENT")
+		case "LAST-MODIFIED":
+			current.Updated, _, _ = parseTime(prop, loc)
+		case "DTSTART":
+			if current.Start, allDay, err = parseTime(prop, loc); err != nil {
+				return nil, fmt.Errorf("invalid DTSTART: %w", err)
+			}
+		case "DTEND":
+			if current.End, _, err = parseTime(prop, loc); err != nil {
+				return nil, fmt.Errorf("invalid DTEND: %w", err)
+			}
+		case "DURATION":
+			if duration, err = parseDuration(prop.value); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return events, nil
+}
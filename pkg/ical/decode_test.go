@@ -0,0 +1,179 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecodeRoundTrip(t *testing.T) {
+	events := []Event{
+		{
+			UID:         "appointment-1@careflow",
+			Summary:     "Checkup, Dr. House; room 2",
+			Description: strings.Repeat("Bring your previous prescriptions and results.\n", 4),
+			Location:    `Clinic \ Centre, Tunis`,
+			Start:       time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC),
+			End:         time.Date(2026, 3, 10, 9, 30, 0, 0, time.UTC),
+			Status:      StatusConfirmed,
+			Updated:     time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+		},
+		{
+			UID:         "busy,1@careflow",
+			Summary:     "موعد",
+			Start:       time.Date(2026, 3, 11, 14, 0, 0, 0, time.UTC),
+			End:         time.Date(2026, 3, 11, 15, 0, 0, 0, time.UTC),
+			Status:      StatusCancelled,
+			Transparent: true,
+			Updated:     time.Date(2026, 3, 2, 8, 15, 0, 0, time.UTC),
+		},
+	}
+
+	var out bytes.Buffer
+	if err := (&Calendar{Name: "CareFlow", Events: events}).Encode(&out); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := Decode(&out, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(events) {
+		t.Fatalf("decoded %d events, want %d", len(decoded), len(events))
+	}
+
+	for i, want := range events {
+		got := decoded[i]
+		if got.UID != want.UID || got.Summary != want.Summary || got.Description != want.Description ||
+			got.Location != want.Location || got.Status != want.Status || got.Transparent != want.Transparent {
+			t.Errorf("event %d = %+v, want %+v", i, got, want)
+		}
+		if !got.Start.Equal(want.Start) || !got.End.Equal(want.End) || !got.Updated.Equal(want.Updated) {
+			t.Errorf("event %d times = %v - %v (%v), want %v - %v (%v)", i, got.Start, got.End, got.Updated, want.Start, want.End, want.Updated)
+		}
+	}
+}
+
+func TestDecode(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		event     string
+		wantStart time.Time
+		wantEnd   time.Time
+		wantErr   bool
+	}{
+		{
+			name:      "utc times",
+			event:     "DTSTART:20260310T090000Z\nDTEND:20260310T093000Z",
+			wantStart: time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 3, 10, 9, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "time zone parameter",
+			event:     "DTSTART;TZID=Europe/Paris:20260310T090000\nDTEND;TZID=Europe/Paris:20260310T100000",
+			wantStart: time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "quoted time zone parameter",
+			event:     "DTSTART;TZID=\"Europe/Paris\":20260310T090000\nDURATION:PT45M",
+			wantStart: time.Date(2026, 3, 10, 8, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 3, 10, 8, 45, 0, 0, time.UTC),
+		},
+		{
+			name:      "floating time read in the given zone",
+			event:     "DTSTART:20260310T090000\nDTEND:20260310T093000",
+			wantStart: time.Date(2026, 3, 10, 9, 0, 0, 0, paris),
+			wantEnd:   time.Date(2026, 3, 10, 9, 30, 0, 0, paris),
+		},
+		{
+			name:      "all day event lasts a day",
+			event:     "DTSTART;VALUE=DATE:20260310",
+			wantStart: time.Date(2026, 3, 10, 0, 0, 0, 0, paris),
+			wantEnd:   time.Date(2026, 3, 11, 0, 0, 0, 0, paris),
+		},
+		{
+			name:      "no end",
+			event:     "DTSTART:20260310T090000Z",
+			wantStart: time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC),
+		},
+		{
+			name:      "alarm properties are skipped",
+			event:     "DTSTART:20260310T090000Z\nBEGIN:VALARM\nTRIGGER:-PT15M\nDTSTART:20990101T000000Z\nEND:VALARM\nDURATION:PT1H",
+			wantStart: time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC),
+			wantEnd:   time.Date(2026, 3, 10, 10, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "missing start",
+			event:   "DTEND:20260310T093000Z",
+			wantErr: true,
+		},
+		{
+			name:    "invalid start",
+			event:   "DTSTART:tomorrow",
+			wantErr: true,
+		},
+		{
+			name:    "invalid duration",
+			event:   "DTSTART:20260310T090000Z\nDURATION:1 hour",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			document := "BEGIN:VCALENDAR\r\nBEGIN:VEVENT\r\nUID:1\r\n" +
+				strings.ReplaceAll(tt.event, "\n", "\r\n") +
+				"\r\nEND:VEVENT\r\nEND:VCALENDAR\r\n"
+
+			events, err := Decode(strings.NewReader(document), paris)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Decode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if len(events) != 1 {
+				t.Fatalf("decoded %d events, want 1", len(events))
+			}
+			if !events[0].Start.Equal(tt.wantStart) || !events[0].End.Equal(tt.wantEnd) {
+				t.Errorf("Decode() = %v - %v, want %v - %v", events[0].Start, events[0].End, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"PT30M", 30 * time.Minute, false},
+		{"PT1H30M", 90 * time.Minute, false},
+		{"P1D", 24 * time.Hour, false},
+		{"P1W", 7 * 24 * time.Hour, false},
+		{"P1DT2H", 26 * time.Hour, false},
+		{"-PT15M", -15 * time.Minute, false},
+		{"PT45S", 45 * time.Second, false},
+		{"30M", 0, true},
+		{"", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := parseDuration(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDuration(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDuration(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
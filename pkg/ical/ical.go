@@ -0,0 +1,124 @@
+package ical
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// event statuses from RFC 5545
+const (
+	StatusConfirmed = "CONFIRMED"
+	StatusTentative = "TENTATIVE"
+	StatusCancelled = "CANCELLED"
+)
+
+const timestampFormat = "20060102T150405Z"
+
+var sequenceEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+type Event struct {
+	UID         string
+	Summary     string
+	Description string
+	Location    string
+	Start       time.Time
+	End         time.Time
+	Status      string
+	// transparent events don't make the owner busy (TRANSP:TRANSPARENT)
+	Transparent bool
+	// when the event last changed, calendar apps use it to pick up updates
+	Updated time.Time
+}
+
+type Calendar struct {
+	Name   string
+	Events []Event
+}
+
+// escapes a text value (RFC 5545 section 3.3.11)
+func escape(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, ";", `\;`)
+	value = strings.ReplaceAll(value, ",", `\,`)
+	value = strings.ReplaceAll(value, "\r\n", `\n`)
+	return strings.ReplaceAll(value, "\n", `\n`)
+}
+
+func timestamp(t time.Time) string {
+	return t.UTC().Format(timestampFormat)
+}
+
+// writes a content line folded at 75 octets without splitting utf-8 characters
+func writeLine(w *bufio.Writer, line string) {
+	limit := 75
+	for len(line) > limit {
+		cut := limit
+		for cut > 0 && !utf8.RuneStart(line[cut]) {
+			cut--
+		}
+		w.WriteString(line[:cut])
+		w.WriteString("\r\n ")
+		line = line[cut:]
+		// continuation lines start with a space
+		limit = 74
+	}
+	w.WriteString(line)
+	w.WriteString("\r\n")
+}
+
+// minutes since a fixed date, grows every time the event changes
+func sequence(updated time.Time) int {
+	return int(updated.Sub(sequenceEpoch) / time.Minute)
+}
+
+// writes the calendar as an iCalendar (RFC 5545) document
+func (c *Calendar) Encode(out io.Writer) error {
+	w := bufio.NewWriter(out)
+	now := time.Now()
+
+	writeLine(w, "BEGIN:VCALENDAR")
+	writeLine(w, "VERSION:2.0")
+	writeLine(w, "PRODID:-//CareFlow//Appointments//EN")
+	writeLine(w, "CALSCALE:GREGORIAN")
+	writeLine(w, "METHOD:PUBLISH")
+	if c.Name != "" {
+		writeLine(w, "X-WR-CALNAME:"+escape(c.Name))
+	}
+
+	for _, event := range c.Events {
+		updated := event.Updated
+		if updated.IsZero() {
+			updated = now
+		}
+
+		writeLine(w, "BEGIN:VEVENT")
+		writeLine(w, "UID:"+escape(event.UID))
+		writeLine(w, "DTSTAMP:"+timestamp(now))
+		writeLine(w, "LAST-MODIFIED:"+timestamp(updated))
+		// the sequence has to grow with every change for clients to replace the event
+		writeLine(w, "SEQUENCE:"+strconv.Itoa(sequence(updated)))
+		writeLine(w, "DTSTART:"+timestamp(event.Start))
+		writeLine(w, "DTEND:"+timestamp(event.End))
+		writeLine(w, "SUMMARY:"+escape(event.Summary))
+		if event.Description != "" {
+			writeLine(w, "DESCRIPTION:"+escape(event.Description))
+		}
+		if event.Location != "" {
+			writeLine(w, "LOCATION:"+escape(event.Location))
+		}
+		if event.Status != "" {
+			writeLine(w, "STATUS:"+event.Status)
+		}
+		if event.Transparent {
+			writeLine(w, "TRANSP:TRANSPARENT")
+		}
+		writeLine(w, "END:VEVENT")
+	}
+
+	writeLine(w, "END:VCALENDAR")
+	return w.Flush()
+}
@@ -0,0 +1,89 @@
+package ical
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestEscape(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+	}{
+		{"Checkup", "Checkup"},
+		{"Dr. House, MD", `Dr. House\, MD`},
+		{"a;b", `a\;b`},
+		{`C:\notes`, `C:\\notes`},
+		{"line one\nline two", `line one\nline two`},
+		{"line one\r\nline two", `line one\nline two`},
+	}
+
+	for _, tt := range tests {
+		if got := escape(tt.value); got != tt.want {
+			t.Errorf("escape(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestEncodeFoldsLongLines(t *testing.T) {
+	tests := []struct {
+		name        string
+		description string
+	}{
+		{"ascii", strings.Repeat("Bring your previous prescriptions. ", 10)},
+		{"multi byte characters", strings.Repeat("رسالة إلى الطبيب é ", 20)},
+		{"exactly one line", strings.Repeat("x", 75-len("DESCRIPTION:"))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calendar := Calendar{Events: []Event{{
+				UID:         "appointment-1@careflow",
+				Summary:     "Checkup",
+				Description: tt.description,
+				Start:       time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC),
+				End:         time.Date(2026, 3, 10, 9, 30, 0, 0, time.UTC),
+			}}}
+
+			var out bytes.Buffer
+			if err := calendar.Encode(&out); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, line := range strings.Split(out.String(), "\r\n") {
+				if len(line) > 75 {
+					t.Errorf("line of %d octets: %q", len(line), line)
+				}
+				if !utf8.ValidString(line) {
+					t.Errorf("line splits a character: %q", line)
+				}
+			}
+
+			unfolded := strings.ReplaceAll(out.String(), "\r\n ", "")
+			if want := "\r\nDESCRIPTION:" + escape(tt.description) + "\r\n"; !strings.Contains(unfolded, want) {
+				t.Errorf("unfolded document %q does not contain %q", unfolded, want)
+			}
+		})
+	}
+}
+
+func TestSequenceGrowsWithUpdates(t *testing.T) {
+	first := time.Date(2026, 3, 10, 9, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name  string
+		later time.Time
+	}{
+		{"a minute later", first.Add(time.Minute)},
+		{"a day later", first.AddDate(0, 0, 1)},
+		{"a year later", first.AddDate(1, 0, 0)},
+	}
+
+	for _, tt := range tests {
+		if sequence(tt.later) <= sequence(first) {
+			t.Errorf("%s: sequence %d is not above %d", tt.name, sequence(tt.later), sequence(first))
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package mails
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"os"
+	"path/filepath"
+
+	"github.com/YahiaJouini/careflow/internal/config"
+	"gopkg.in/gomail.v2"
+)
+
+// renders one of the html templates stored next to this file
+func renderTemplate(name string, data any) (string, error) {
+	var body bytes.Buffer
+	currentDir, _ := os.Getwd()
+	templatePath := filepath.Join(currentDir, "pkg", "mails", name)
+
+	tmpl, err := template.New(name).ParseFiles(templatePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	if err := tmpl.Execute(&body, data); err != nil {
+		return "", fmt.Errorf("error executing template: %w", err)
+	}
+	return body.String(), nil
+}
+
+func deliver(sendTo string, subject string, html string) Result {
+	smtpHost := "smtp.gmail.com"
+	smtpPort := 587
+	emailSender, _ := config.GetEnv("EMAIL_SENDER")
+	emailPassword, _ := config.GetEnv("EMAIL_PASSWORD")
+
+	message := gomail.NewMessage()
+	message.SetHeader("From", emailSender)
+	message.SetHeader("To", sendTo)
+	message.SetHeader("Subject", subject)
+	message.SetBody("text/html", html)
+
+	dialer := gomail.NewDialer(smtpHost, smtpPort, emailSender, emailPassword)
+
+	if err := dialer.DialAndSend(message); err != nil {
+		fmt.Println("error sending mail", err)
+		return Failure(err)
+	}
+	return Success()
+}
@@ -0,0 +1,20 @@
+package mails
+
+import "fmt"
+
+type Notification struct {
+	Subject string
+	Heading string
+	// one paragraph per line
+	Lines []string
+}
+
+func SendNotification(sendTo string, notification Notification) Result {
+	body, err := renderTemplate("notification.html", notification)
+	if err != nil {
+		fmt.Println(err)
+		return Failure(err)
+	}
+
+	return deliver(sendTo, notification.Subject, body)
+}
@@ -2,7 +2,10 @@ package response
 
 import (
 	"encoding/json"
+	"log"
 	"net/http"
+
+	"github.com/YahiaJouini/careflow/pkg/ical"
 )
 
 type Response struct {
@@ -60,3 +63,16 @@ func ServerError(w http.ResponseWriter, errors ...string) {
 		Error:   errorMsg,
 	})
 }
+
+// sends an iCalendar document, as a download when a filename is given
+func Calendar(w http.ResponseWriter, calendar *ical.Calendar, filename string) {
+	w.Header().Set("Content-Type", "text/calendar; charset=utf-8")
+	if filename != "" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+	}
+	w.WriteHeader(http.StatusOK)
+	if err := calendar.Encode(w); err != nil {
+		// the status is already sent, the client gets a truncated calendar
+		log.Println("failed to write calendar:", err)
+	}
+}